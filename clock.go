@@ -0,0 +1,32 @@
+package life
+
+import "time"
+
+// Clock is the source of time of timeouts in life, see SetClock().
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var clock Clock = realClock{}
+
+// SetClock replaces the clock used by hook timeouts, signal shutdown timeout
+// and idle shutdown, nil restores the real clock. Use a fake clock in tests to
+// trigger timeouts instantly. Can only be called in Initing state.
+func SetClock(c Clock) {
+	ensureStatef(Initing, "[%s] Can not set clock in \"%v\" state", tag, State())
+	if c == nil {
+		c = realClock{}
+	}
+	clock = c
+}
@@ -0,0 +1,129 @@
+package life
+
+import (
+	"sync"
+	"time"
+)
+
+// guards pkgs, hooks, startedCount, and start/shutdown records of pkg, read
+// by Debug() concurrently.
+var infoL sync.Mutex
+
+// DebugInfo is a snapshot of life, see Debug().
+type DebugInfo struct {
+	State      StateT
+	Generation uint64
+
+	// Packages in start order after started, registration order before,
+	// packages of a group follow the group package.
+	Packages []PackageInfo
+
+	// Roots and Leaves are names of packages, see Roots() and Leaves().
+	Roots  []string
+	Leaves []string
+
+	// Hooks in registration order, keyed by hook type name, such as
+	// "BeforeRunning".
+	Hooks map[string][]HookInfo
+
+	// HookOrder is Hooks in executing order, see HookOrder().
+	HookOrder map[string][]HookInfo
+
+	StartDeadline   time.Duration
+	ShutdownTimeout time.Duration
+	DrainTime       time.Duration
+}
+
+// PackageInfo is a snapshot of a registered package.
+type PackageInfo struct {
+	Name     string
+	Depends  []string
+	Priority int
+	Phase    int
+
+	// Started is true if onStart returned, StartDur is the time it took.
+	Started  bool
+	StartDur time.Duration
+
+	// Stopped is true if shutdown callbacks returned, StopDur is the time
+	// they took.
+	Stopped bool
+	StopDur time.Duration
+
+	// Meta is RegisterOpts.Meta of the package.
+	Meta map[string]string
+}
+
+// HookInfo is a snapshot of a registered hook.
+type HookInfo struct {
+	Name  string
+	Order int
+}
+
+// Debug returns a snapshot of life for debugging, such as payload of a
+// debug http endpoint. Safe to call in any state, from any goroutine, even
+// inside callbacks.
+func Debug() DebugInfo {
+	r := DebugInfo{
+		State:           State(),
+		Generation:      Generation(),
+		Hooks:           make(map[string][]HookInfo, numHookTypes),
+		HookOrder:       make(map[string][]HookInfo, numHookTypes),
+		StartDeadline:   startDeadline,
+		ShutdownTimeout: shutdownTimeout,
+		DrainTime:       drainTime,
+	}
+
+	infoL.Lock()
+	defer infoL.Unlock()
+
+	r.Packages = packageInfos()
+	r.Roots, r.Leaves = rootNames(pkgs), leafNames(pkgs)
+	for typ, items := range hooks {
+		if len(items) == 0 {
+			continue
+		}
+
+		name := hookType(typ).String()
+		r.Hooks[name] = hookInfos(items)
+		r.HookOrder[name] = hookInfos(sortedHooks(hookType(typ)))
+	}
+	return r
+}
+
+func hookInfos(items []*hook) []HookInfo {
+	r := make([]HookInfo, len(items))
+	for i, h := range items {
+		r[i] = HookInfo{h.name, h.order}
+	}
+	return r
+}
+
+// packageInfos returns snapshot of registered packages, must be called with
+// infoL locked.
+func packageInfos() []PackageInfo {
+	list := allPackages(pkgs)
+	r := make([]PackageInfo, len(list))
+	for i, p := range list {
+		var meta map[string]string
+		if p.meta != nil {
+			meta = make(map[string]string, len(p.meta))
+			for k, v := range p.meta {
+				meta[k] = v
+			}
+		}
+
+		r[i] = PackageInfo{
+			Name:     p.name,
+			Depends:  append([]string(nil), p.depends...),
+			Priority: p.priority,
+			Phase:    p.phase,
+			Started:  p.started,
+			StartDur: p.startDur,
+			Stopped:  p.stopped,
+			StopDur:  p.stopDur,
+			Meta:     meta,
+		}
+	}
+	return r
+}
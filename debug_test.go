@@ -0,0 +1,87 @@
+package life_test
+
+import (
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Debug", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Initing", func() {
+		Register("a", nil, nil, "b")
+		RegisterWithOpts("b", nil, nil, RegisterOpts{Priority: 1})
+		RegisterHook("foo", 3, BeforeRunning, func() {})
+		RegisterHook("bar", 1, BeforeRunning, func() {})
+
+		info := Debug()
+		Ω(info.State).Should(Equal(Initing))
+		Ω(info.Generation).Should(Equal(Generation()))
+		Ω(info.Packages).Should(Equal([]PackageInfo{
+			{Name: "a", Depends: []string{"b"}},
+			{Name: "b", Priority: 1},
+		}))
+		Ω(info.Hooks).Should(Equal(map[string][]HookInfo{
+			"BeforeRunning": {{"foo", 3}, {"bar", 1}},
+		}))
+		Ω(info.HookOrder).Should(Equal(map[string][]HookInfo{
+			"BeforeRunning": {{"bar", 1}, {"foo", 3}},
+		}))
+		Ω(info.ShutdownTimeout).Should(Equal(60 * time.Second))
+	})
+
+	It("Started and stopped", func() {
+		var inStart DebugInfo
+		Register("a", nil, nil, "b")
+		Register("b", func() {
+			time.Sleep(time.Millisecond)
+			inStart = Debug()
+		}, nil)
+		Start()
+
+		Ω(inStart.State).Should(Equal(Starting))
+		Ω(inStart.Packages[0].Started).Should(BeFalse())
+
+		info := Debug()
+		Ω(info.Packages[0].Name).Should(Equal("b"))
+		Ω(info.Packages[0].Started).Should(BeTrue())
+		Ω(info.Packages[0].StartDur).Should(BeNumerically(">=", time.Millisecond))
+		Ω(info.Packages[1].Stopped).Should(BeFalse())
+
+		Shutdown()
+		info = Debug()
+		Ω(info.Packages[0].Stopped).Should(BeTrue())
+		Ω(info.Packages[1].Stopped).Should(BeTrue())
+	})
+
+	It("Deep copy", func() {
+		RegisterWithOpts("a", nil, nil, RegisterOpts{Depends: []string{"b"}, Meta: map[string]string{"owner": "infra"}})
+		Debug().Packages[0].Depends[0] = "c"
+		Debug().Packages[0].Meta["owner"] = "web"
+		Ω(Debug().Packages[0].Depends).Should(Equal([]string{"b"}))
+		Ω(Debug().Packages[0].Meta).Should(Equal(map[string]string{"owner": "infra"}))
+	})
+
+	It("Packages", func() {
+		RegisterWithOpts("a", nil, nil, RegisterOpts{Meta: map[string]string{"owner": "infra", "tier": "1"}})
+		Register("b", nil, nil)
+		Ω(Packages()).Should(Equal([]PackageInfo{
+			{Name: "a", Meta: map[string]string{"owner": "infra", "tier": "1"}},
+			{Name: "b"},
+		}))
+		Ω(Packages()).Should(Equal(Debug().Packages))
+	})
+
+})
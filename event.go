@@ -0,0 +1,131 @@
+//go:generate stringer -type=EventKind -trimprefix=Event
+
+package life
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventKind is the kind of Event.
+type EventKind int
+
+const (
+	// EventStateChanged sent after life state changed, see Event.From and
+	// Event.To.
+	EventStateChanged EventKind = iota
+
+	// EventPackageStarted sent after onStart callback of package returned.
+	EventPackageStarted
+
+	// EventPackageStopped sent after onShutdown callbacks of package
+	// returned.
+	EventPackageStopped
+
+	// EventPackageFailed sent if onStart or onShutdown callback of package
+	// panics, see Event.Err.
+	EventPackageFailed
+
+	// EventHookExecuted sent after a hook returned.
+	EventHookExecuted
+)
+
+// Event is a life event received from Subscribe().
+type Event struct {
+	Kind EventKind
+
+	// Name of the package or hook, empty for EventStateChanged.
+	Name string
+
+	// From and To states of EventStateChanged.
+	From, To StateT
+
+	// Duration of the callback or hook.
+	Duration time.Duration
+
+	// Err recovered from the failed callback of EventPackageFailed.
+	Err error
+}
+
+const defaultEventBufferSize = 64
+
+var (
+	// guards subscribers
+	subscribersL sync.Mutex
+	subscribers  map[chan Event]struct{}
+
+	// buffer size of event channels, see SetEventBufferSize()
+	eventBufferSize = defaultEventBufferSize
+
+	// number of events dropped, see DroppedEvents()
+	droppedEvents uint64
+)
+
+// SetEventBufferSize set the buffer size of channels returned by Subscribe()
+// and StartProgress(), default 64. Events are sent without blocking, the
+// event dropped if the channel buffer full, so that a slow or absent consumer
+// never stalls life, enlarge the buffer if events dropped, see
+// DroppedEvents(). Call it before StartProgress(), it recreates the progress
+// channel. Can only be called in Initing state.
+func SetEventBufferSize(n int) {
+	ensureStatef(Initing, "[%s] Can not set event buffer size in \"%v\" state", tag, State())
+	if n < 0 {
+		log.Panicf("[%s] Negative event buffer size %d", tag, n)
+	}
+	eventBufferSize = n
+	progress = make(chan StartEvent, n)
+}
+
+// DroppedEvents returns number of events dropped because channel buffer
+// full, of all subscribers and the progress channel, in current generation.
+func DroppedEvents() uint64 {
+	return atomic.LoadUint64(&droppedEvents)
+}
+
+// Subscribe returns a channel receiving life events, such as state changes,
+// package start and stop, hook executions and failures, for a live
+// dashboard. Call the returned function to unsubscribe, it closes the
+// channel. Multiple subscribers receive the same events. Like
+// StartProgress(), events are sent without blocking, dropped if the channel
+// buffer full, see SetEventBufferSize().
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+	subscribersL.Lock()
+	defer subscribersL.Unlock()
+	if subscribers == nil {
+		subscribers = make(map[chan Event]struct{})
+	}
+	subscribers[ch] = struct{}{}
+	return ch, func() {
+		subscribersL.Lock()
+		defer subscribersL.Unlock()
+		if _, exist := subscribers[ch]; exist {
+			delete(subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func publishEvent(e Event) {
+	subscribersL.Lock()
+	defer subscribersL.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+			atomic.AddUint64(&droppedEvents, 1)
+		}
+	}
+}
+
+// resetSubscribers closes channels of all subscribers.
+func resetSubscribers() {
+	subscribersL.Lock()
+	defer subscribersL.Unlock()
+	for ch := range subscribers {
+		close(ch)
+	}
+	subscribers = nil
+}
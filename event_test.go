@@ -0,0 +1,124 @@
+package life_test
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/hal"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Subscribe", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	// receive events until ch closed, durations cleared.
+	receive := func(ch <-chan Event) []Event {
+		var r []Event
+		for e := range ch {
+			e.Duration = 0
+			r = append(r, e)
+		}
+		return r
+	}
+
+	It("Events", func() {
+		ch, unsubscribe := Subscribe()
+		Register("pkg", nil, nil)
+		RegisterHook("hook", 0, BeforeRunning, newLogFunc("hook"))
+		Start()
+		Shutdown()
+		unsubscribe()
+		unsubscribe()
+		Ω(receive(ch)).Should(Equal([]Event{
+			{Kind: EventStateChanged, From: Initing, To: Starting},
+			{Kind: EventPackageStarted, Name: "pkg"},
+			{Kind: EventHookExecuted, Name: "hook"},
+			{Kind: EventStateChanged, From: Starting, To: Running},
+			{Kind: EventStateChanged, From: Running, To: Shutingdown},
+			{Kind: EventPackageStopped, Name: "pkg"},
+			{Kind: EventStateChanged, From: Shutingdown, To: Halt},
+		}))
+		Ω(EventHookExecuted.String()).Should(Equal("HookExecuted"))
+	})
+
+	It("Failure", func() {
+		SetShutdownPolicy(BestEffort)
+		Register("pkg", nil, func() {
+			panic(errors.New("pkg"))
+		})
+		Start()
+		ch, unsubscribe := Subscribe()
+		Shutdown()
+		unsubscribe()
+		Ω(receive(ch)).Should(ContainElement(Event{Kind: EventPackageFailed, Name: "pkg", Err: errors.New("pkg")}))
+	})
+
+	It("Exited", func() {
+		hal.Exit = func(int) {}
+		Start()
+		ch, unsubscribe := Subscribe()
+		Abort()
+		Abort()
+		unsubscribe()
+		Ω(receive(ch)).Should(Equal([]Event{
+			{Kind: EventStateChanged, From: Running, To: Exited},
+		}))
+	})
+
+	It("Consumer never reads", func() {
+		SetEventBufferSize(1)
+		ch, _ := Subscribe()
+		for i := 0; i < 10; i++ {
+			Register(fmt.Sprintf("pkg%d", i), nil, nil)
+		}
+		Start()
+		Ω(State()).Should(Equal(Running))
+		Ω(ch).Should(HaveLen(1))
+		Ω(StartProgress()).Should(HaveLen(1))
+		// 10 package events and a state event to each channel, one buffered
+		Ω(DroppedEvents()).Should(BeNumerically(">=", 20))
+
+		reset.Disable()
+		reset.Enable()
+		Ω(DroppedEvents()).Should(BeZero())
+	})
+
+	It("SetEventBufferSize", func() {
+		Ω(func() {
+			SetEventBufferSize(-1)
+		}).Should(matcher.Panics("[life] Negative event buffer size -1"))
+		Start()
+		Ω(func() {
+			SetEventBufferSize(1)
+		}).Should(matcher.Panics(`[life] Can not set event buffer size in "Running" state`))
+	})
+
+	It("Multiple subscribers closed on reset", func() {
+		ch1, _ := Subscribe()
+		ch2, unsubscribe := Subscribe()
+		Start()
+		reset.Disable()
+		reset.Enable()
+		unsubscribe()
+		events := receive(ch1)
+		Ω(events[:2]).Should(Equal([]Event{
+			{Kind: EventStateChanged, From: Initing, To: Starting},
+			{Kind: EventStateChanged, From: Starting, To: Running},
+		}))
+		Ω(receive(ch2)).Should(Equal(events))
+	})
+
+})
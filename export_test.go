@@ -0,0 +1,55 @@
+package life
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// ForceState set the internal state directly, to test corrupt state handling.
+func ForceState(st StateT) {
+	lock()
+	defer unlock()
+	enterState(st)
+}
+
+// SetState exports setState(), which rejects illegal transitions.
+func SetState(st StateT) {
+	lock()
+	defer unlock()
+	setState(st)
+}
+
+// HandleSignals exports handleSignals() to test signal triggered shutdown,
+// ends on the shutdown complete of current life cycle.
+func HandleSignals(c <-chan os.Signal, after func(time.Duration) <-chan time.Time) {
+	handleSignals(c, shutdown, after)
+}
+
+// IsStartCancelled exports isStartCancelled().
+var IsStartCancelled = isStartCancelled
+
+// CountSignalMonitor replaces the signal monitor launcher with a counter of
+// launches, returns the counter and a function to restore the launcher.
+func CountSignalMonitor() (launches *int, restore func()) {
+	backup := launchSignalMonitor
+	launches = new(int)
+	launchSignalMonitor = func(*sync.WaitGroup, <-chan struct{}) {
+		*launches++
+	}
+	return launches, func() {
+		launchSignalMonitor = backup
+	}
+}
+
+// SetReExecArgs replaces arguments of the new process started by ReExec(),
+// returns a function to restore.
+func SetReExecArgs(args ...string) (restore func()) {
+	backup := reExecArgs
+	reExecArgs = func() []string {
+		return args
+	}
+	return func() {
+		reExecArgs = backup
+	}
+}
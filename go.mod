@@ -8,5 +8,4 @@ require (
 	github.com/redforks/errors v1.0.1
 	github.com/redforks/hal v1.0.0
 	github.com/redforks/testing v1.0.0
-	github.com/stevenle/topsort v0.0.0-20130922064739-8130c1d7596b
 )
@@ -0,0 +1,38 @@
+package life
+
+import (
+	"sync"
+	"time"
+)
+
+// background goroutines of life, see WaitGoroutines()
+var goroutines sync.WaitGroup
+
+// goBackground runs fn in a new goroutine, waited by WaitGoroutines().
+func goBackground(fn func()) {
+	goroutines.Add(1)
+	go func() {
+		defer goroutines.Done()
+		fn()
+	}()
+}
+
+// WaitGoroutines blocks until background goroutines of life exit, such as
+// ShutdownOn() watchers and workers of RegisterWorkers(), returns false on
+// timeout. Watchers exit on shutdown complete, workers on shutdown of their
+// package. Use it after shutdown, such as to assert no goroutine leaks in
+// tests. The signal monitor not counted, it runs until the process exits.
+func WaitGoroutines(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		goroutines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package life
+
+import "log"
+
+// Group is a set of packages with their own dependency order, registered to
+// life as a single package by RegisterGroup(). Packages of the group start
+// inside onStart callback of the group package, and shutdown inside its
+// onShutdown callback. Use it to encapsulate packages of a feature behind one
+// dependency name.
+//
+// The zero value is an empty group ready to use.
+type Group struct {
+	pkgs []*pkg
+
+	// number of started packages
+	started int
+}
+
+// Register a package to the group like life.Register(), depends refer to
+// packages of the same group.
+func (g *Group) Register(name string, onStart, onShutdown Callback, depends ...string) {
+	g.RegisterWithOpts(name, onStart, onShutdown, RegisterOpts{Depends: depends})
+}
+
+// RegisterWithOpts register a package to the group like
+// life.RegisterWithOpts().
+func (g *Group) RegisterWithOpts(name string, onStart, onShutdown Callback, opts RegisterOpts) {
+	if err := register(&g.pkgs, name, onStart, onShutdown, opts); err != nil {
+		log.Panicf("[%s] %s", tag, err)
+	}
+}
+
+// RegisterGroup register group as a single package of life. Packages of the
+// group are visible to introspection, such as Packages() and
+// PackageStartedChan(), following the group package.
+func RegisterGroup(name string, group *Group, depends ...string) {
+	Register(name, group.start, group.shutdown, depends...)
+	infoL.Lock()
+	defer infoL.Unlock()
+	pkgs[len(pkgs)-1].group = group
+}
+
+func (g *Group) start() {
+	sorted, err := sortByDependency(g.pkgs)
+	if err != nil {
+		log.Panicf("[%s] %s", tag, err)
+	}
+	infoL.Lock()
+	g.pkgs = sorted
+	infoL.Unlock()
+
+	defer func() {
+		if err := recover(); err != nil {
+			// group package not started, shutdown started packages of the
+			// group, parent shutdown packages started before the group.
+			g.shutdown()
+			panic(err)
+		}
+	}()
+
+	for _, p := range g.pkgs {
+		startPackage(p)
+		g.started++
+	}
+}
+
+func (g *Group) shutdown() {
+	doShutdownPackages(g.pkgs[:g.started])
+	g.started = 0
+}
+
+// allPackages returns list with packages of groups following their group
+// package, must be called with infoL locked.
+func allPackages(list []*pkg) []*pkg {
+	r := make([]*pkg, 0, len(list))
+	for _, p := range list {
+		r = append(r, p)
+		if p.group != nil {
+			r = append(r, allPackages(p.group.pkgs)...)
+		}
+	}
+	return r
+}
@@ -0,0 +1,113 @@
+package life_test
+
+import (
+	"strconv"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/hal"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Group", func() {
+	var g *Group
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+		g = &Group{}
+
+		hal.Exit = func(n int) {
+			appendLog("Exit " + strconv.Itoa(n))
+		}
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Start and shutdown as one package", func() {
+		g.Register("b", newLogFunc("start b"), newLogFunc("stop b"), "a")
+		g.Register("a", newLogFunc("start a"), newLogFunc("stop a"))
+		Register("before", newLogFunc("start before"), newLogFunc("stop before"))
+		RegisterGroup("group", g, "before")
+		Register("after", newLogFunc("start after"), newLogFunc("stop after"), "group")
+
+		Start()
+		assertLog("start before\nstart a\nstart b\nstart after\n")
+		Shutdown()
+		assertLog("stop after\nstop b\nstop a\nstop before\n")
+	})
+
+	It("Package failed in group", func() {
+		g.Register("a", newLogFunc("start a"), newLogFunc("stop a"))
+		g.Register("b", func() {
+			panic("b")
+		}, newLogFunc("stop b"))
+		Register("before", newLogFunc("start before"), newLogFunc("stop before"))
+		RegisterGroup("group", g, "before")
+
+		Ω(Start).Should(Panic())
+		assertLog("start before\nstart a\nstop a\nstop before\nExit 10\n")
+	})
+
+	It("Names of group are separated", func() {
+		g.Register("a", newLogFunc("group a"), nil)
+		Register("a", newLogFunc("a"), nil)
+		RegisterGroup("group", g)
+		Start()
+		assertLog("a\ngroup a\n")
+	})
+
+	It("Packages of group started like others", func() {
+		var panicked []string
+		SetPanicPolicy(func(phase, pkg string, _ interface{}) PanicAction {
+			panicked = append(panicked, pkg)
+			return PanicContinue
+		})
+		g.Register("a", nil, nil)
+		g.Register("b", func() {
+			panic("b")
+		}, nil, "a")
+		RegisterGroup("group", g)
+		Register("after", nil, nil, "group")
+
+		Start()
+		Ω(panicked).Should(Equal([]string{"b"}))
+		Ω(isClosed(PackageStartedChan("b"))).Should(BeTrue())
+
+		var names []string
+		for _, p := range Packages() {
+			Ω(p.Started).Should(BeTrue())
+			names = append(names, p.Name)
+		}
+		Ω(names).Should(Equal([]string{"group", "a", "b", "after"}))
+
+		var events []StartEvent
+		for e := range StartProgress() {
+			events = append(events, e)
+		}
+		Ω(events).Should(Equal([]StartEvent{
+			{"group", PackageStarting},
+			{"a", PackageStarting},
+			{"a", PackageStarted},
+			{"b", PackageStarting},
+			{"b", PackageStarted},
+			{"group", PackageStarted},
+			{"after", PackageStarting},
+			{"after", PackageStarted},
+		}))
+	})
+
+	It("Register in wrong state", func() {
+		RegisterGroup("group", g)
+		Start()
+		Ω(func() {
+			g.Register("a", nil, nil)
+		}).Should(matcher.Panics("[life] Can not register package \"a\" in \"Running\" state"))
+	})
+
+})
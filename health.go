@@ -0,0 +1,125 @@
+package life
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+var (
+	// see RegisterHealthCheck()
+	healthChecks []healthCheck
+
+	// max duration of each health check, see SetHealthCheckTimeout()
+	healthCheckTimeout = defaultHealthCheckTimeout
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// RegisterHealthCheck register liveness/readiness check of package name,
+// run by CheckHealth() and HealthHandler(). A check fails if returns error,
+// panics, or not returns in health check timeout, it should return early if
+// ctx done. Can only be called in Initing state.
+func RegisterHealthCheck(name string, check func(ctx context.Context) error) {
+	ensureStatef(Initing, "[%s] Can not register health check \"%s\" in \"%v\" state", tag, name, State())
+	healthChecks = append(healthChecks, healthCheck{name, check})
+}
+
+// SetHealthCheckTimeout set max duration of each health check, default 5
+// seconds. Can only be called in Initing state.
+func SetHealthCheckTimeout(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set health check timeout in \"%v\" state", tag, State())
+	healthCheckTimeout = d
+}
+
+// CheckHealth runs all health checks concurrently, returns errors of failed
+// checks by name, nil if all pass.
+func CheckHealth(ctx context.Context) map[string]error {
+	var (
+		l      sync.Mutex
+		failed map[string]error
+		wg     sync.WaitGroup
+	)
+	timeout := healthCheckTimeout
+	for _, c := range healthChecks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+			if err := runHealthCheck(ctx, c, timeout); err != nil {
+				l.Lock()
+				defer l.Unlock()
+				if failed == nil {
+					failed = make(map[string]error)
+				}
+				failed[c.name] = err
+			}
+		}(c)
+	}
+	wg.Wait()
+	return failed
+}
+
+func runHealthCheck(ctx context.Context, c healthCheck, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- toError(r)
+			}
+		}()
+		result <- c.check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check timeout: %v", ctx.Err())
+	}
+}
+
+// HealthStatus is the JSON body of HealthHandler().
+type HealthStatus struct {
+	State   string            `json:"state"`
+	Healthy bool              `json:"healthy"`
+	Checks  map[string]string `json:"checks"`
+}
+
+// HealthHandler returns http handler runs all health checks by
+// CheckHealth(), responds HealthStatus in JSON, status of each check is "ok"
+// or its error. Responds 200 if all checks pass and Ready(), otherwise 503,
+// so load balancers stop routing to application not yet Running, in
+// pre-shutdown delay, or shutting down.
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed := CheckHealth(r.Context())
+		status := HealthStatus{
+			State:   State().String(),
+			Healthy: len(failed) == 0 && Ready(),
+			Checks:  make(map[string]string, len(healthChecks)),
+		}
+		for _, c := range healthChecks {
+			status.Checks[c.name] = "ok"
+		}
+		for name, err := range failed {
+			status.Checks[name] = err.Error()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
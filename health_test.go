@@ -0,0 +1,111 @@
+package life_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Health", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	pass := func(context.Context) error {
+		return nil
+	}
+
+	serve := func() (int, HealthStatus) {
+		rec := httptest.NewRecorder()
+		HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+		var status HealthStatus
+		Ω(json.Unmarshal(rec.Body.Bytes(), &status)).Should(Succeed())
+		Ω(rec.Header().Get("Content-Type")).Should(Equal("application/json"))
+		return rec.Code, status
+	}
+
+	It("Healthy", func() {
+		RegisterHealthCheck("db", pass)
+		RegisterHealthCheck("cache", pass)
+		Start()
+		Ω(CheckHealth(context.Background())).Should(BeNil())
+		code, status := serve()
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(status).Should(Equal(HealthStatus{
+			State:   "Running",
+			Healthy: true,
+			Checks:  map[string]string{"db": "ok", "cache": "ok"},
+		}))
+	})
+
+	It("Unhealthy", func() {
+		SetHealthCheckTimeout(10 * time.Millisecond)
+		RegisterHealthCheck("db", pass)
+		RegisterHealthCheck("cache", func(context.Context) error {
+			return errors.New("connection refused")
+		})
+		RegisterHealthCheck("queue", func(context.Context) error {
+			panic("queue")
+		})
+		RegisterHealthCheck("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		code, status := serve()
+		Ω(code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(status).Should(Equal(HealthStatus{
+			State:   "Initing",
+			Healthy: false,
+			Checks: map[string]string{
+				"db":    "ok",
+				"cache": "connection refused",
+				"queue": "queue",
+				"slow":  "health check timeout: context deadline exceeded",
+			},
+		}))
+	})
+
+	It("Not ready", func() {
+		RegisterHealthCheck("db", pass)
+		code, status := serve()
+		Ω(code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(status).Should(Equal(HealthStatus{
+			State:   "Initing",
+			Healthy: false,
+			Checks:  map[string]string{"db": "ok"},
+		}))
+
+		Register("web", nil, func() {
+			code, status = serve()
+		})
+		Start()
+		Shutdown()
+		Ω(code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(status.State).Should(Equal("Shutingdown"))
+		Ω(status.Healthy).Should(BeFalse())
+	})
+
+	It("Register in wrong state", func() {
+		Start()
+		Ω(func() {
+			RegisterHealthCheck("db", pass)
+		}).Should(matcher.Panics(`[life] Can not register health check "db" in "Running" state`))
+	})
+
+})
@@ -5,6 +5,7 @@ package life
 import (
 	"log"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/redforks/testing/reset"
@@ -13,6 +14,11 @@ import (
 // HookFunc called when a hook event occurred. See hookType constants.
 type HookFunc func()
 
+// AbortHookFunc is OnAbort hook receiving the cause of abort, cause is the
+// recovered value if start or shutdown failed, the error passed to
+// AbortWith(), or nil.
+type AbortHookFunc func(cause error)
+
 type hookType int
 
 const (
@@ -29,43 +35,162 @@ const (
 	// even before your package initialized, check your hooks to work on any states,
 	// do not assume opened file, socket, channel, etc.
 	OnAbort
+
+	// OnDrain hooks called on entering Draining state, at the beginning of
+	// shutdown. Use it to stop accepting new work, such as deregister from
+	// service discovery.
+	OnDrain
+
+	// AfterShutdown hooks called after all onShutdown callbacks succeed,
+	// before WaitToEnd() returns.
+	AfterShutdown
+
+	numHookTypes = int(AfterShutdown) + 1
 )
 
 type hook struct {
 	name  string
 	order int
 	fn    HookFunc
+
+	// not nil if registered by RegisterAbortHook()
+	abortFn AbortHookFunc
 }
 
 var (
-	hooks = make([][]*hook, 4)
+	hooks = make([][]*hook, numHookTypes)
+
+	// cause passed to AbortHookFunc, guarded by abortL
+	abortL     sync.Mutex
+	abortCause error
+
+	// guards hookTimings and lastTimeout
+	timingsL    sync.Mutex
+	hookTimings = make([][]HookTiming, numHookTypes)
+
+	// the last timed out hook, see LastHookTimeout()
+	lastTimeout *timedOutHook
 )
 
+type timedOutHook struct {
+	typ  hookType
+	name string
+}
+
 // RegisterHook register a function that executed when typ hook event occurred. Name is
-// used in log only. If multiple function hook to one hookType, they executed
+// used in log and DeregisterHook(), panics if typ hook with the same name
+// already registered. If multiple function hook to one hookType, they executed
 // by order, smaller execute first, If two hooks have the same order, they will
 // execute in any order.
 func RegisterHook(name string, order int, typ hookType, fn HookFunc) {
-	if State() != Initing {
-		log.Panicf("[%s] Can not register hook \"%s\" in \"%v\" state", tag, name, state)
-	}
-
-	hooks[typ] = append(hooks[typ], &hook{
+	addHook(typ, &hook{
 		name:  name,
 		order: order,
 		fn:    fn,
 	})
 }
 
+// RegisterAbortHook register an OnAbort hook receiving the cause of abort,
+// like RegisterHook(name, order, OnAbort, fn).
+func RegisterAbortHook(name string, order int, fn AbortHookFunc) {
+	addHook(OnAbort, &hook{
+		name:    name,
+		order:   order,
+		abortFn: fn,
+	})
+}
+
+func addHook(typ hookType, h *hook) {
+	if State() != Initing {
+		log.Panicf("[%s] Can not register hook \"%s\" in \"%v\" state", tag, h.name, state)
+	}
+
+	if findHook(h.name, typ) >= 0 {
+		log.Panicf("[%s] %v hook \"%s\" already registered", tag, typ, h.name)
+	}
+	infoL.Lock()
+	defer infoL.Unlock()
+	hooks[typ] = append(hooks[typ], h)
+}
+
+// findHook returns index of typ hook named name, -1 if not found.
+func findHook(name string, typ hookType) int {
+	for i, h := range hooks[typ] {
+		if h.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// DeregisterHook removes typ hook named name, returns false if not found.
+// Hook names are unique in each hook type. Can only be called in Initing
+// state.
+func DeregisterHook(name string, typ hookType) bool {
+	ensureStatef(Initing, "[%s] Can not deregister hook \"%s\" in \"%v\" state", tag, name, State())
+
+	i := findHook(name, typ)
+	if i < 0 {
+		return false
+	}
+	infoL.Lock()
+	defer infoL.Unlock()
+	hooks[typ] = append(hooks[typ][:i], hooks[typ][i+1:]...)
+	return true
+}
+
+func callAbortHooks(cause error) {
+	abortL.Lock()
+	abortCause = cause
+	abortL.Unlock()
+	callHooks(OnAbort)
+}
+
 func callHooks(typ hookType) {
 	wait := make(chan interface{})
+
+	var (
+		// guards variables below, shared with the goroutine running hooks
+		mu sync.Mutex
+		// name and start time of the executing hook, reported on timeout
+		running  string
+		runStart time.Time
+		timings  []HookTiming
+		timedOut bool
+	)
+
+	items := sortedHooks(typ)
+	if len(items) == 0 {
+		// nothing to run, no timeout even if shutdown budget exhausted
+		timingsL.Lock()
+		defer timingsL.Unlock()
+		hookTimings[typ] = nil
+		return
+	}
+
+	clk := clock
+	abortL.Lock()
+	cause := abortCause
+	abortL.Unlock()
 	go func() {
-		items := hooks[typ]
-		sort.Sort(sortHook(items))
 		for _, hook := range items {
-			log.Printf("[%s] Execute %v hook: %s", tag, typ, hook.name)
-			hook.fn()
-			log.Printf("[%s] Done %s", tag, hook.name)
+			debugf("Execute %v hook: %s", typ, hook.name)
+			mu.Lock()
+			running, runStart = hook.name, clk.Now()
+			mu.Unlock()
+			if hook.abortFn != nil {
+				hook.abortFn(cause)
+			} else {
+				hook.fn()
+			}
+			mu.Lock()
+			d := clk.Now().Sub(runStart)
+			if !timedOut {
+				timings = append(timings, HookTiming{hook.name, d, false})
+			}
+			mu.Unlock()
+			publishEvent(Event{Kind: EventHookExecuted, Name: hook.name, Duration: d})
+			debugf("Done %s", hook.name)
 		}
 		close(wait)
 	}()
@@ -74,11 +199,88 @@ func callHooks(typ hookType) {
 	if reset.TestMode() {
 		timeout = time.Second
 	}
+	if typ != OnAbort {
+		timeout = budgetTimeout(timeout)
+	}
+	var timeoutHook *timedOutHook
 	select {
 	case <-wait:
-	case <-time.After(timeout):
-		log.Printf("[%s] %v hook timeout", tag, typ)
+	case <-clk.After(timeout):
+		mu.Lock()
+		timedOut = true
+		timings = append(timings, HookTiming{running, clk.Now().Sub(runStart), true})
+		timeoutHook = &timedOutHook{typ, running}
+		mu.Unlock()
+		warnf("%v hook timeout while running \"%s\"", typ, timeoutHook.name)
 	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	timingsL.Lock()
+	defer timingsL.Unlock()
+	hookTimings[typ] = timings
+	if timeoutHook != nil {
+		lastTimeout = timeoutHook
+	}
+}
+
+// HookTiming is the execution record of a hook, see HookTimings().
+type HookTiming struct {
+	Name string
+	Dur  time.Duration
+
+	// TimedOut is true if the hook still running on timeout, Dur is the time
+	// until timeout. Hooks after the timed out one are not recorded.
+	TimedOut bool
+}
+
+// HookTimings returns execution records of the last run of typ hooks in
+// executed order, nil if typ hooks not executed yet.
+func HookTimings(typ hookType) []HookTiming {
+	timingsL.Lock()
+	defer timingsL.Unlock()
+	return append([]HookTiming(nil), hookTimings[typ]...)
+}
+
+// LastHookRunOrder returns names of typ hooks in the order they actually ran
+// in the last run of typ hooks, including the timed out one, nil if typ hooks
+// not executed yet in current generation.
+func LastHookRunOrder(typ hookType) []string {
+	timingsL.Lock()
+	defer timingsL.Unlock()
+	var r []string
+	for _, t := range hookTimings[typ] {
+		r = append(r, t.Name)
+	}
+	return r
+}
+
+// LastHookTimeout returns type and name of the last timed out hook, false if
+// no hook timed out, such as to assert which hook timed out in tests.
+func LastHookTimeout() (hookType, string, bool) {
+	timingsL.Lock()
+	defer timingsL.Unlock()
+	if lastTimeout == nil {
+		return 0, "", false
+	}
+	return lastTimeout.typ, lastTimeout.name, true
+}
+
+// sortedHooks returns typ hooks in executing order, sorts a copy, hooks may
+// be read by Debug() concurrently.
+func sortedHooks(typ hookType) []*hook {
+	items := append([]*hook(nil), hooks[typ]...)
+	sort.Sort(sortHook(items))
+	return items
+}
+
+// HookOrder returns registered typ hooks in executing order, with their order
+// values, to find out unexpected ties of hook order. Safe to call from any
+// goroutine.
+func HookOrder(typ hookType) []HookInfo {
+	infoL.Lock()
+	defer infoL.Unlock()
+	return hookInfos(sortedHooks(typ))
 }
 
 type sortHook []*hook
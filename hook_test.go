@@ -1,10 +1,17 @@
 package life_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
 	"strconv"
+	"time"
 
 	. "github.com/redforks/life"
 
+	"github.com/redforks/testing/matcher"
 	"github.com/redforks/testing/reset"
 
 	bdd "github.com/onsi/ginkgo"
@@ -59,6 +66,107 @@ var _ = bdd.Describe("hook", func() {
 		assertLog("onStart\nbar\nfoo\nonShutdown\n")
 	})
 
+	bdd.Context("OnDrain", func() {
+
+		bdd.It("Skip draining if not configured", func() {
+			RegisterHook("foo", 0, BeforeShutingdown, func() {
+				Ω(State()).Should(Equal(Shutingdown))
+			})
+			Start()
+			Shutdown()
+			assertLog("onStart\nonShutdown\n")
+		})
+
+		bdd.It("Before BeforeShutingdown", func() {
+			RegisterHook("drain", 0, OnDrain, func() {
+				appendLog("drain")
+				Ω(State()).Should(Equal(Draining))
+				Ω(Ready()).Should(BeFalse())
+				Ω(Live()).Should(BeTrue())
+			})
+			RegisterHook("foo", 0, BeforeShutingdown, newLogFunc("foo"))
+			Start()
+			Ω(Ready()).Should(BeTrue())
+			Shutdown()
+			assertLog("onStart\ndrain\nfoo\nonShutdown\n")
+			Ω(Live()).Should(BeFalse())
+		})
+
+		bdd.It("Drain time", func() {
+			SetDrainTime(10 * time.Millisecond)
+			Start()
+			start := time.Now()
+			Shutdown()
+			Ω(time.Since(start)).Should(BeNumerically(">=", 10*time.Millisecond))
+		})
+
+		bdd.It("Set drain time in wrong state", func() {
+			Start()
+			Ω(func() {
+				SetDrainTime(time.Second)
+			}).Should(Panic())
+		})
+
+	})
+
+	bdd.Context("Ordering", func() {
+
+		bdd.BeforeEach(func() {
+			RegisterHook("BeforeStarting", 0, BeforeStarting, newLogFunc("BeforeStarting"))
+			RegisterHook("BeforeRunning", 0, BeforeRunning, newLogFunc("BeforeRunning"))
+			RegisterHook("OnDrain", 0, OnDrain, newLogFunc("OnDrain"))
+			RegisterHook("BeforeShutingdown", 0, BeforeShutingdown, newLogFunc("BeforeShutingdown"))
+			RegisterHook("AfterShutdown", 0, AfterShutdown, newLogFunc("AfterShutdown"))
+			RegisterHook("OnAbort", 0, OnAbort, newLogFunc("OnAbort"))
+		})
+
+		bdd.It("Succeed", func() {
+			Register("bar", newLogFunc("onStart bar"), newLogFunc("onShutdown bar"), "foo")
+			Start()
+			Shutdown()
+			assertLog(`BeforeStarting
+onStart
+onStart bar
+BeforeRunning
+OnDrain
+BeforeShutingdown
+onShutdown bar
+onShutdown
+AfterShutdown
+`)
+		})
+
+		bdd.It("Start failed", func() {
+			Register("bar", func() {
+				panic("bar")
+			}, newLogFunc("onShutdown bar"), "foo")
+			Ω(Start).Should(Panic())
+			assertLog(`BeforeStarting
+onStart
+onShutdown
+OnAbort
+Exit 10
+`)
+		})
+
+		bdd.It("Shutdown failed", func() {
+			Register("bar", nil, func() {
+				panic("bar")
+			}, "foo")
+			Start()
+			Ω(Shutdown).Should(Panic())
+			assertLog(`BeforeStarting
+onStart
+BeforeRunning
+OnDrain
+BeforeShutingdown
+OnAbort
+Exit 11
+`)
+		})
+
+	})
+
 	bdd.It("Abort because start failed", func() {
 		Register("panic", func() {
 			panic("foo")
@@ -71,6 +179,51 @@ var _ = bdd.Describe("hook", func() {
 		assertLog("onStart\nonShutdown\nfoo\nbar\nExit 10\n")
 	})
 
+	bdd.Context("Abort cause", func() {
+		var logCause = func(cause error) {
+			appendLog(fmt.Sprintf("cause: %v", cause))
+		}
+
+		bdd.It("Start failed", func() {
+			Register("panic", func() {
+				panic("foo")
+			}, nil)
+			RegisterAbortHook("cause", 0, logCause)
+			RegisterHook("bar", 1, OnAbort, newLogFunc("bar"))
+
+			Ω(Start).Should(Panic())
+			assertLog("onStart\nonShutdown\ncause: foo\nbar\nExit 10\n")
+		})
+
+		bdd.It("Shutdown failed", func() {
+			err := errors.New("foo")
+			Register("panic", nil, func() {
+				panic(err)
+			})
+			RegisterAbortHook("cause", 0, func(cause error) {
+				Ω(cause).Should(BeIdenticalTo(err))
+				appendLog("cause")
+			})
+
+			Start()
+			Ω(Shutdown).Should(Panic())
+			assertLog("onStart\ncause\nExit 11\n")
+		})
+
+		bdd.It("AbortWith", func() {
+			RegisterAbortHook("cause", 0, logCause)
+			AbortWith(errors.New("bar"))
+			assertLog("cause: bar\nExit 12\n")
+		})
+
+		bdd.It("Abort", func() {
+			RegisterAbortHook("cause", 0, logCause)
+			Abort()
+			assertLog("cause: <nil>\nExit 12\n")
+		})
+
+	})
+
 	bdd.It("Abort because shutdow failed", func() {
 		Register("panic", nil, func() {
 			panic("foo")
@@ -85,6 +238,10 @@ var _ = bdd.Describe("hook", func() {
 	})
 
 	bdd.It("Hooks timeout", func() {
+		w, done := newLogWaiter(os.Stderr, "Done bar")
+		log.SetOutput(w)
+		defer log.SetOutput(os.Stderr)
+
 		hold := make(chan interface{})
 		wait := make(chan interface{})
 
@@ -101,8 +258,120 @@ var _ = bdd.Describe("hook", func() {
 			close(wait)
 		}()
 
+		_, _, ok := LastHookTimeout()
+		Ω(ok).Should(BeFalse())
 		Eventually(wait, 1.5).Should(BeClosed(), "abort hooks timeout")
+		typ, name, ok := LastHookTimeout()
+		Ω(ok).Should(BeTrue())
+		Ω(typ).Should(Equal(OnAbort))
+		Ω(name).Should(Equal("bar"))
+		close(hold)
+		<-done
+	})
+
+	bdd.It("Log timeout hook name", func() {
+		var buf bytes.Buffer
+		w, done := newLogWaiter(&buf, "Done slow")
+		log.SetOutput(w)
+		defer log.SetOutput(os.Stderr)
+
+		hold := make(chan interface{})
+		RegisterHook("fast", 0, BeforeRunning, func() {})
+		RegisterHook("slow", 1, BeforeRunning, func() {
+			<-hold
+		})
+		Start()
+		Ω(buf.String()).Should(ContainSubstring(`[life] BeforeRunning hook timeout while running "slow"`))
+
+		timings := HookTimings(BeforeRunning)
+		Ω(timings).Should(HaveLen(2))
+		Ω(timings[0].Name).Should(Equal("fast"))
+		Ω(timings[0].TimedOut).Should(BeFalse())
+		Ω(timings[1].Name).Should(Equal("slow"))
+		Ω(timings[1].TimedOut).Should(BeTrue())
+		Ω(timings[1].Dur).Should(BeNumerically(">", 900*time.Millisecond))
 		close(hold)
+		<-done
+	})
+
+	bdd.It("Fake clock", func() {
+		var buf bytes.Buffer
+		w, done := newLogWaiter(&buf, "Done slow")
+		log.SetOutput(w)
+		defer log.SetOutput(os.Stderr)
+
+		hold := make(chan interface{})
+		clk := &fakeClock{time.Unix(0, 0), make(chan time.Time, 1)}
+		SetClock(clk)
+		RegisterHook("slow", 0, BeforeRunning, func() {
+			// time out now
+			clk.after <- clk.now
+			<-hold
+		})
+		begin := time.Now()
+		Start()
+		Ω(time.Since(begin)).Should(BeNumerically("<", 500*time.Millisecond))
+		Ω(buf.String()).Should(ContainSubstring(`[life] BeforeRunning hook timeout while running "slow"`))
+		Ω(HookTimings(BeforeRunning)).Should(Equal([]HookTiming{{Name: "slow", TimedOut: true}}))
+		close(hold)
+		<-done
+
+		Ω(func() {
+			SetClock(nil)
+		}).Should(matcher.Panics(`[life] Can not set clock in "Running" state`))
+	})
+
+	bdd.It("HookTimings", func() {
+		Ω(HookTimings(BeforeStarting)).Should(BeNil())
+		RegisterHook("foo", 0, BeforeStarting, func() {
+			time.Sleep(5 * time.Millisecond)
+		})
+		RegisterHook("bar", 1, BeforeStarting, func() {})
+		Start()
+
+		timings := HookTimings(BeforeStarting)
+		Ω(timings).Should(HaveLen(2))
+		Ω(timings[0].Name).Should(Equal("foo"))
+		Ω(timings[0].Dur).Should(BeNumerically(">=", 5*time.Millisecond))
+		Ω(timings[1].Name).Should(Equal("bar"))
+		Ω(timings[1].TimedOut).Should(BeFalse())
+		Ω(HookTimings(BeforeShutingdown)).Should(BeNil())
+	})
+
+	bdd.Context("Name", func() {
+
+		bdd.It("Duplicate name of the same type", func() {
+			RegisterHook("foo", 0, BeforeStarting, func() {})
+			Ω(func() {
+				RegisterHook("foo", 1, BeforeStarting, func() {})
+			}).Should(matcher.Panics(`[life] BeforeStarting hook "foo" already registered`))
+			Ω(func() {
+				RegisterAbortHook("bar", 0, func(error) {})
+				RegisterHook("bar", 0, OnAbort, func() {})
+			}).Should(matcher.Panics(`[life] Abort hook "bar" already registered`))
+		})
+
+		bdd.It("Same name of different types", func() {
+			RegisterHook("foo", 0, BeforeStarting, newLogFunc("starting"))
+			RegisterHook("foo", 0, BeforeRunning, newLogFunc("running"))
+			Start()
+			assertLog("starting\nonStart\nrunning\n")
+		})
+
+		bdd.It("Deregister", func() {
+			RegisterHook("foo", 0, BeforeStarting, newLogFunc("foo"))
+			RegisterHook("bar", 1, BeforeStarting, newLogFunc("bar"))
+			RegisterHook("foo", 0, BeforeRunning, newLogFunc("running"))
+			Ω(DeregisterHook("foo", BeforeStarting)).Should(BeTrue())
+			Ω(DeregisterHook("foo", BeforeStarting)).Should(BeFalse())
+			Start()
+			assertLog("bar\nonStart\nrunning\n")
+
+			Ω(func() {
+				DeregisterHook("bar", BeforeStarting)
+			}).Should(matcher.Panics(`[life] Can not deregister hook "bar" in "Running" state`))
+		})
+
 	})
 
 	bdd.It("Sort by order", func() {
@@ -113,4 +382,37 @@ var _ = bdd.Describe("hook", func() {
 		assertLog("bar\nfoo\nfoobar\nonStart\n")
 	})
 
+	bdd.It("LastHookRunOrder", func() {
+		RegisterHook("foo", 10, BeforeStarting, func() {})
+		RegisterHook("bar", 9, BeforeStarting, func() {})
+		Ω(LastHookRunOrder(BeforeStarting)).Should(BeNil())
+		Start()
+		Ω(LastHookRunOrder(BeforeStarting)).Should(Equal([]string{"bar", "foo"}))
+
+		reset.Disable()
+		reset.Enable()
+		Ω(LastHookRunOrder(BeforeStarting)).Should(BeNil())
+	})
+
+	bdd.It("HookOrder", func() {
+		RegisterHook("foo", 10, BeforeStarting, func() {})
+		RegisterHook("bar", 9, BeforeStarting, func() {})
+		Ω(HookOrder(BeforeStarting)).Should(Equal([]HookInfo{{"bar", 9}, {"foo", 10}}))
+		Ω(HookOrder(AfterShutdown)).Should(BeEmpty())
+	})
+
 })
+
+// fakeClock stops at now, its After() fires when a value sent to after.
+type fakeClock struct {
+	now   time.Time
+	after chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(time.Duration) <-chan time.Time {
+	return c.after
+}
@@ -0,0 +1,76 @@
+package life
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// see RegisterIdleShutdown()
+	idleTimeout time.Duration
+	isIdle      func() bool
+
+	// time of last IdleActivity() in UnixNano
+	lastActivity int64
+)
+
+// RegisterIdleShutdown register a function reports whether the system is
+// idle, if idle for d, Shutdown() called automatically, such as a batch
+// worker exits after no work for scale-to-zero deployment. The idle monitor
+// runs in Running state, stops if shutdown by other reasons. Call
+// IdleActivity() to restart the idle period on activity. d must be positive.
+// Only one idle shutdown can be registered. Can only be called in Initing
+// state.
+func RegisterIdleShutdown(d time.Duration, idle func() bool) {
+	ensureStatef(Initing, "[%s] Can not register idle shutdown in \"%v\" state", tag, State())
+	if d <= 0 {
+		log.Panicf("[%s] Idle period must be positive, got %v", tag, d)
+	}
+	if isIdle != nil {
+		log.Panicf("[%s] Idle shutdown already registered", tag)
+	}
+	idleTimeout, isIdle = d, idle
+}
+
+// IdleActivity restarts the idle period of RegisterIdleShutdown(), such as
+// on each job done. Safe to call in any state.
+func IdleActivity() {
+	atomic.StoreInt64(&lastActivity, clock.Now().UnixNano())
+}
+
+// watchIdle checks idle() every quarter of d by clk, calls Shutdown() if idle
+// for d, until done closed.
+func watchIdle(clk Clock, d time.Duration, idle func() bool, done <-chan struct{}, ready *sync.WaitGroup) {
+	interval := d / 4
+	if interval == 0 {
+		interval = d
+	}
+	ready.Done()
+
+	var since time.Time
+	for {
+		select {
+		case now := <-clk.After(interval):
+			if !idle() {
+				since = time.Time{}
+				continue
+			}
+			if since.IsZero() {
+				since = now
+			}
+			if act := time.Unix(0, atomic.LoadInt64(&lastActivity)); act.After(since) {
+				since = act
+			}
+			if now.Sub(since) >= d {
+				logf("Idle for %v, start shutdown", d)
+				setShutdownCause(CauseIdle, nil)
+				Shutdown()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
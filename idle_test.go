@@ -0,0 +1,89 @@
+package life_test
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Idle shutdown", func() {
+
+	var idle int32
+
+	BeforeEach(func() {
+		reset.Enable()
+		atomic.StoreInt32(&idle, 1)
+		RegisterIdleShutdown(20*time.Millisecond, func() bool {
+			return atomic.LoadInt32(&idle) == 1
+		})
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Shutdown when idle", func() {
+		Start()
+		info := WaitToEndInfo()
+		Ω(info.Cause).Should(Equal(CauseIdle))
+		Ω(info.Cause.String()).Should(Equal("Idle"))
+	})
+
+	It("Busy", func() {
+		atomic.StoreInt32(&idle, 0)
+		Start()
+		Consistently(State, 0.06).Should(Equal(Running))
+		atomic.StoreInt32(&idle, 1)
+		Eventually(State).Should(Equal(Halt))
+	})
+
+	It("Activity restarts idle period", func() {
+		Start()
+		for i := 0; i < 10; i++ {
+			IdleActivity()
+			time.Sleep(5 * time.Millisecond)
+		}
+		Ω(State()).Should(Equal(Running))
+		Eventually(State).Should(Equal(Halt))
+	})
+
+	It("Stops on shutdown", func() {
+		Start()
+		Shutdown()
+		Ω(ShutdownReason()).Should(Equal(CauseProgrammatic))
+	})
+
+	It("Idle by clock", func() {
+		t0 := time.Unix(0, 0)
+		clk := &fakeClock{t0, make(chan time.Time)}
+		SetClock(clk)
+		Start()
+		clk.after <- t0
+		clk.after <- t0.Add(15 * time.Millisecond)
+		Ω(State()).Should(Equal(Running))
+		clk.after <- t0.Add(20 * time.Millisecond)
+		Ω(WaitToEndInfo().Cause).Should(Equal(CauseIdle))
+	})
+
+	It("Non-positive period", func() {
+		Ω(func() {
+			RegisterIdleShutdown(0, nil)
+		}).Should(matcher.Panics("[life] Idle period must be positive, got 0s"))
+		Ω(func() {
+			RegisterIdleShutdown(-time.Second, nil)
+		}).Should(matcher.Panics("[life] Idle period must be positive, got -1s"))
+	})
+
+	It("Register twice", func() {
+		Ω(func() {
+			RegisterIdleShutdown(time.Second, nil)
+		}).Should(matcher.Panics("[life] Idle shutdown already registered"))
+	})
+
+})
@@ -0,0 +1,76 @@
+package life
+
+import (
+	"log"
+	"sync"
+)
+
+var (
+	// guards inFlight and inFlightDone
+	inFlightL sync.Mutex
+	// number of in-flight requests, see Acquire()
+	inFlight int
+	// closed when inFlight drops to zero, nil if no request in flight
+	inFlightDone chan struct{}
+)
+
+// Acquire marks a request in flight, Shutdown() waits for all in-flight
+// requests released before BeforeShutingdown hooks, up to shutdown timeout.
+// Such as a http middleware calls Acquire() on request entry, and Release()
+// on exit:
+//
+//	life.Acquire()
+//	defer life.Release()
+func Acquire() {
+	inFlightL.Lock()
+	defer inFlightL.Unlock()
+	if inFlight == 0 {
+		inFlightDone = make(chan struct{})
+	}
+	inFlight++
+}
+
+// Release marks a request acquired by Acquire() complete. Panics if no
+// request in flight.
+func Release() {
+	inFlightL.Lock()
+	defer inFlightL.Unlock()
+	if inFlight == 0 {
+		log.Panicf("[%s] Release without Acquire", tag)
+	}
+	inFlight--
+	if inFlight == 0 {
+		close(inFlightDone)
+		inFlightDone = nil
+	}
+}
+
+// InFlight returns number of in-flight requests, see Acquire().
+func InFlight() int {
+	inFlightL.Lock()
+	defer inFlightL.Unlock()
+	return inFlight
+}
+
+// waitInFlight waits all in-flight requests released, up to shutdown timeout.
+func waitInFlight() {
+	inFlightL.Lock()
+	n, done := inFlight, inFlightDone
+	inFlightL.Unlock()
+	if done == nil {
+		return
+	}
+
+	logf("Wait %d in-flight requests", n)
+	select {
+	case <-done:
+	case <-clock.After(budgetTimeout(shutdownTimeout)):
+		warnf("In-flight requests timeout, %d not released", InFlight())
+	}
+}
+
+func resetInFlight() {
+	inFlightL.Lock()
+	defer inFlightL.Unlock()
+	inFlight, inFlightDone = 0, nil
+}
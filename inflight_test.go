@@ -0,0 +1,64 @@
+package life_test
+
+import (
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("InFlight", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("No request in flight", func() {
+		RegisterHook("before", 0, BeforeShutingdown, newLogFunc("before"))
+		Start()
+		Shutdown()
+		assertLog("before\n")
+	})
+
+	It("Wait requests released", func() {
+		RegisterHook("before", 0, BeforeShutingdown, newLogFunc("before"))
+		Start()
+		Acquire()
+		Acquire()
+		Ω(InFlight()).Should(Equal(2))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			appendLog("release")
+			Release()
+			Release()
+		}()
+		Shutdown()
+		Ω(InFlight()).Should(Equal(0))
+		assertLog("release\nbefore\n")
+	})
+
+	It("Timeout", func() {
+		SetShutdownTimeout(10 * time.Millisecond)
+		RegisterHook("before", 0, BeforeShutingdown, newLogFunc("before"))
+		Start()
+		Acquire()
+		Shutdown()
+		Ω(InFlight()).Should(Equal(1))
+		assertLog("before\n")
+		Release()
+	})
+
+	It("Release without Acquire", func() {
+		Ω(Release).Should(matcher.Panics("[life] Release without Acquire"))
+	})
+
+})
@@ -0,0 +1,121 @@
+package life
+
+import "log"
+
+// StartOrder returns names of registered packages, in the order their
+// onStart callbacks will be called. Returns error if packages can not be
+// sorted, such as loop dependency.
+func StartOrder() ([]string, error) {
+	sorted, err := sortByDependency(pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, len(sorted))
+	for i, p := range sorted {
+		result[i] = p.name
+	}
+	return result, nil
+}
+
+// ShutdownOrder returns names of registered packages, in the order their
+// onShutdown callbacks will be called, i.e. reversed StartOrder() unless
+// reordered by RegisterOpts.ShutdownPriority.
+func ShutdownOrder() ([]string, error) {
+	sorted, err := sortByDependency(pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := shutdownSequence(sorted)
+	result := make([]string, len(seq))
+	for i, p := range seq {
+		result[i] = p.name
+	}
+	return result, nil
+}
+
+// Packages returns snapshot of registered packages, in start order after
+// started, registration order before. Safe to call in any state.
+func Packages() []PackageInfo {
+	infoL.Lock()
+	defer infoL.Unlock()
+	return packageInfos()
+}
+
+// Roots returns names of packages no other package depends on, they start
+// last, the top of the application. In the order of Packages(). Safe to call
+// in any state.
+func Roots() []string {
+	infoL.Lock()
+	defer infoL.Unlock()
+	return rootNames(pkgs)
+}
+
+// Leaves returns names of packages depend on nothing, they start first, the
+// foundation of the application. In the order of Packages(). Safe to call in
+// any state.
+func Leaves() []string {
+	infoL.Lock()
+	defer infoL.Unlock()
+	return leafNames(pkgs)
+}
+
+// rootNames returns names of packages in list no package depends on, by name
+// or alias, must be called with infoL locked.
+func rootNames(list []*pkg) []string {
+	g, _ := newDepGraph(list, nil)
+	var r []string
+	for _, p := range list {
+		if len(g.dependents[p]) == 0 {
+			r = append(r, p.name)
+		}
+	}
+	return r
+}
+
+// leafNames returns names of packages in list without dependency, must be
+// called with infoL locked.
+func leafNames(list []*pkg) []string {
+	var r []string
+	for _, p := range list {
+		if len(p.depends) == 0 {
+			r = append(r, p.name)
+		}
+	}
+	return r
+}
+
+// number of packages started by Start(), see StartedPackages()
+var startedCount int
+
+// StartedPackages returns number of packages started by Start() and number
+// of all packages. After a start failure, tells how far the start went, the
+// failed package not counted. Safe to call in any state.
+func StartedPackages() (started, total int) {
+	infoL.Lock()
+	defer infoL.Unlock()
+	return startedCount, len(pkgs)
+}
+
+// Disabled returns names of packages disabled by RegisterIf(), in the order of
+// registration.
+func Disabled() []string {
+	return append([]string(nil), disabled...)
+}
+
+// PackageStartedChan returns a channel closed after onStart of package name
+// returned. Panics if the package not registered.
+func PackageStartedChan(name string) <-chan struct{} {
+	infoL.Lock()
+	defer infoL.Unlock()
+
+	key := normalizeName(name)
+	for _, p := range allPackages(pkgs) {
+		if normalizeName(p.name) == key {
+			return p.startedCh
+		}
+	}
+	log.Panicf("[%s] Package \"%s\" not registered", tag, name)
+	return nil
+}
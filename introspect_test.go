@@ -0,0 +1,174 @@
+package life_test
+
+import (
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("introspect", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	Context("StartOrder and ShutdownOrder", func() {
+
+		It("Empty", func() {
+			Ω(StartOrder()).Should(BeEmpty())
+			Ω(ShutdownOrder()).Should(BeEmpty())
+		})
+
+		It("Sorted", func() {
+			var stopped []string
+			reg := func(name string, depends ...string) {
+				Register(name, nil, func() {
+					stopped = append(stopped, name)
+				}, depends...)
+			}
+			reg("a", "b")
+			reg("b")
+			reg("c", "a")
+
+			Ω(StartOrder()).Should(Equal([]string{"b", "a", "c"}))
+			order, err := ShutdownOrder()
+			Ω(err).Should(Succeed())
+			Ω(order).Should(Equal([]string{"c", "a", "b"}))
+
+			Start()
+			Shutdown()
+			Ω(stopped).Should(Equal(order))
+		})
+
+		It("Loop dependency", func() {
+			Register("a", nil, nil, "b")
+			Register("b", nil, nil, "a")
+			_, err := StartOrder()
+			Ω(err).Should(MatchError("Loop dependency detected\n\ta -> b\n\tb -> a"))
+			Ω(err.(*CycleError).Cycle).Should(Equal([]string{"a", "b", "a"}))
+			_, err = ShutdownOrder()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("Cycle path", func() {
+			Register("a", nil, nil, "x")
+			Register("b", nil, nil, "c", "a")
+			Register("c", nil, nil, "d")
+			Register("d", nil, nil, "b")
+			Register("x", nil, nil)
+			_, err := StartOrder()
+			Ω(err.(*CycleError).Cycle).Should(Equal([]string{"b", "c", "d", "b"}))
+		})
+
+	})
+
+	Context("Roots and Leaves", func() {
+
+		It("Empty", func() {
+			Ω(Roots()).Should(BeEmpty())
+			Ω(Leaves()).Should(BeEmpty())
+		})
+
+		It("Topology", func() {
+			Register("a", nil, nil, "b", "c")
+			Register("b", nil, nil, "c")
+			Register("c", nil, nil)
+			Register("d", nil, nil)
+			Ω(Roots()).Should(Equal([]string{"a", "d"}))
+			Ω(Leaves()).Should(Equal([]string{"c", "d"}))
+
+			info := Debug()
+			Ω(info.Roots).Should(Equal([]string{"a", "d"}))
+			Ω(info.Leaves).Should(Equal([]string{"c", "d"}))
+		})
+
+		It("Depend by alias", func() {
+			RegisterWithOpts("db", nil, nil, RegisterOpts{Aliases: []string{"database"}})
+			Register("web", nil, nil, "database")
+			Ω(Roots()).Should(Equal([]string{"web"}))
+			Ω(Leaves()).Should(Equal([]string{"db"}))
+		})
+
+	})
+
+	Context("PackageStartedChan", func() {
+
+		It("Closed after onStart", func() {
+			var inA, inB bool
+			Register("a", func() {
+				inA = isClosed(PackageStartedChan("a"))
+				inB = isClosed(PackageStartedChan("b"))
+			}, nil, "b")
+			Register("b", nil, nil)
+			a, b := PackageStartedChan("a"), PackageStartedChan("b")
+			Ω(a).ShouldNot(BeClosed())
+			Ω(b).ShouldNot(BeClosed())
+
+			Start()
+			Ω(inA).Should(BeFalse())
+			Ω(inB).Should(BeTrue())
+			Ω(a).Should(BeClosed())
+			Ω(b).Should(BeClosed())
+		})
+
+		It("Not registered", func() {
+			Ω(func() {
+				PackageStartedChan("a")
+			}).Should(matcher.Panics(`[life] Package "a" not registered`))
+		})
+
+		It("Recreated on reset", func() {
+			Register("a", nil, nil)
+			Start()
+			Ω(PackageStartedChan("a")).Should(BeClosed())
+
+			reset.Disable()
+			reset.Enable()
+			Register("a", nil, nil)
+			Ω(PackageStartedChan("a")).ShouldNot(BeClosed())
+		})
+
+	})
+
+	Context("RegisterIf", func() {
+
+		It("Enabled", func() {
+			RegisterIf(true, "a", nil, nil)
+			Ω(StartOrder()).Should(Equal([]string{"a"}))
+			Ω(Disabled()).Should(BeEmpty())
+		})
+
+		It("Disabled", func() {
+			RegisterIf(false, "a", nil, nil)
+			Register("b", nil, nil, "a")
+			Ω(StartOrder()).Should(Equal([]string{"b"}))
+			Ω(Disabled()).Should(Equal([]string{"a"}))
+		})
+
+		It("Depends on disabled in strict mode", func() {
+			SetStrictDependencies(true)
+			RegisterIf(false, "a", nil, nil)
+			Register("b", nil, nil, "a")
+			_, err := StartOrder()
+			Ω(err).Should(MatchError(`"b" depends on disabled package "a"`))
+		})
+
+	})
+
+})
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -18,13 +18,30 @@
 //  correct order. Keep calling of Start() inside the package itself, clean and elegant.
 //  Shutdown state enforces all package and go routines exit properly, without
 //  unpredictable state and corrupting data.
+//
+//  Legal state transitions:
+//
+//    Initing -> Starting        Start()
+//    Initing -> Halt            Shutdown() before Start()
+//    Starting -> Running        all packages started
+//    Starting -> Halt           start cancelled or failed
+//    Running -> Draining        Shutdown(), if drain configured
+//    Running -> Shutingdown     Shutdown()
+//    Draining -> Shutingdown    drain done
+//    Shutingdown -> Halt        all packages shutdown
+//    Running, Draining -> Halt  shutdown failed
+//    Halt -> Exited             Exit(), Abort()
+//    any state -> Exited        start or shutdown failed, Exit(), Abort()
 package life
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -35,7 +52,6 @@ import (
 
 	"github.com/redforks/errors"
 	"github.com/redforks/hal"
-	"github.com/stevenle/topsort"
 )
 
 // Callback is callback function called by life package.
@@ -56,6 +72,12 @@ const (
 	// Running is the normal running state, after all packages started.
 	Running
 
+	// Draining is an optional state between Running and Shutingdown, entered
+	// if OnDrain hooks registered or drain time set by SetDrainTime(). Ready()
+	// returns false in this state, so that load balancer stop routing new
+	// requests, while in-flight requests completing.
+	Draining
+
 	// Shutingdown is the state to do the packages shutdown work.
 	Shutingdown
 
@@ -64,8 +86,48 @@ const (
 	// to saw Halt state.
 	Halt
 
-	// tag for log
-	tag = "life"
+	// Exited is the terminal state, set right before process exit, by Exit(),
+	// Abort() or failure of start and shutdown. Background goroutines racing
+	// the exit see this state.
+	Exited
+)
+
+// ParseState returns the state named s, the reverse of StateT.String(), case
+// insensitive, such as to accept state name from admin endpoint or config.
+func ParseState(s string) (StateT, error) {
+	for st := Initing; st <= Exited; st++ {
+		if strings.EqualFold(st.String(), s) {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown state %q", s)
+}
+
+// default tag for log, see SetTag()
+const defaultTag = "life"
+
+// tag for log, see SetTag()
+var tag = defaultTag
+
+// SetTag set the tag prefixed to log lines and panic messages, default
+// "life", such as "life:billing" to tell logs of different applications or
+// sub systems. Can only be called in Initing state.
+func SetTag(t string) {
+	ensureStatef(Initing, "[%s] Can not set tag in \"%v\" state", tag, State())
+	tag = t
+}
+
+// Exit codes used by life package.
+const (
+	// StartFailedExitCode is the exit code if any onStart callback panics.
+	StartFailedExitCode = 10
+
+	// ShutdownFailedExitCode is the exit code if any onShutdown callback
+	// panics.
+	ShutdownFailedExitCode = 11
+
+	// AbortExitCode is the exit code of Abort().
+	AbortExitCode = 12
 )
 
 var (
@@ -81,12 +143,239 @@ var (
 
 	// shutdown chann to notify WaitToEnd. Channel closed on shutdown complete.
 	shutdown = make(chan struct{})
+
+	// time to wait in Draining state, see SetDrainTime()
+	drainTime time.Duration
+
+	// time to wait before signal triggered shutdown, see SetPreShutdownDelay()
+	preShutdownDelay time.Duration
+
+	// 1 if in pre-shutdown delay, Ready() returns false
+	preShutdown int32
+
+	// channels trigger shutdown on close, see ShutdownOn()
+	shutdownOn []<-chan struct{}
+
+	shutdownPolicy ShutdownPolicy
+
+	// errors recovered from onShutdown callbacks in BestEffort policy
+	shutdownErrs ErrorList
+	// guards shutdownErrs appending, packages may shutdown concurrently
+	shutdownErrsL sync.Mutex
+
+	// guards pkg.lateShutdown, can not use `l', OnShutdownLate() maybe
+	// called inside onStart callback.
+	lateL sync.Mutex
+
+	// id of the goroutine holding `l', to detect misuse inside callbacks that
+	// would cause dead-lock.
+	lockOwner int64
+
+	// normalize package names before sorting, nil means exact match
+	nameNormalizer func(string) string
+
+	// abort if start not complete in time, zero means no limit
+	startDeadline time.Duration
+
+	shutdownTimeout = defaultShutdownTimeout
+
+	// gates polled before shutdown, see RegisterShutdownGate()
+	gates []*gate
+
+	// depends on not exist package is an error, see SetStrictDependencies()
+	strictDependencies bool
+
+	// see SetRequireRegisteredDependencies()
+	requireRegistered bool
+
+	// see SetRejectNilCallbacks()
+	rejectNilCallbacks bool
+
+	// see ExitCode()
+	exitCode int32
+
+	// names of packages not registered by RegisterIf(), see Disabled()
+	disabled []string
+
+	// see SetMinRuntime()
+	minRuntime time.Duration
+
+	// monitor SIGINT and SIGTERM to shutdown, see SetSignalHandling()
+	signalHandling = true
+
+	// exit the process on failure or Exit(), see SetExitHandling()
+	exitHandling = true
+
+	// reports recovered panics, see SetErrorHandler()
+	errorHandler = errors.Handle
+
+	// see SetAlwaysRunAbortHooks()
+	alwaysRunAbortHooks bool
+
+	// see Generation()
+	generation uint64
+
+	// time entering Running state in UnixNano, zero if not running yet
+	runningSince int64
+
+	// guards inStart, startCancelled and start context, see cancelStart()
+	startCancelL   sync.Mutex
+	inStart        bool
+	startCancelled bool
+
+	// see StartingContext()
+	startCtx                          = context.Background()
+	startCtxCancel context.CancelFunc = func() {}
 )
 
+const (
+	defaultShutdownTimeout = 60 * time.Second
+
+	// interval to re-poll shutdown gates
+	gatePollInterval = 10 * time.Millisecond
+)
+
+type gate struct {
+	name string
+	fn   func() bool
+}
+
+// ShutdownPolicy decides what to do if an onShutdown callback panics.
+type ShutdownPolicy int
+
+const (
+	// FailFast aborts on the first panic of onShutdown callbacks, exit with
+	// code 11. It is the default policy.
+	FailFast ShutdownPolicy = iota
+
+	// BestEffort recovers panics of onShutdown callbacks and continues to
+	// shutdown the rest packages, Shutdown() completes normally. Recovered
+	// errors are reported by error handler, and returned by ShutdownError().
+	BestEffort
+)
+
+// ErrorList contains multiple errors.
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
 type pkg struct {
 	name                string
 	onStart, onShutdown Callback
 	depends             []string
+	priority            int
+	phase               int
+	startFirst          bool
+	startLast           bool
+	aliases             []string
+	meta                map[string]string
+	shutdownPriority    int
+	quiet               bool
+
+	// packages of the group if registered by RegisterGroup()
+	group *Group
+
+	// registration order, used to break ties in sortByDependency
+	index int
+
+	// closed after onStart returned, see PackageStartedChan()
+	startedCh chan struct{}
+
+	// start and shutdown records, guarded by infoL, see Debug()
+	started, stopped  bool
+	startDur, stopDur time.Duration
+
+	// extra shutdown callbacks added by OnShutdownLate(), guarded by lateL
+	lateShutdown []Callback
+}
+
+// rank is the coarsest start order, lower starts first: -1 for StartFirst,
+// 1 for StartLast, 0 for others.
+func (p *pkg) rank() int {
+	switch {
+	case p.startFirst:
+		return -1
+	case p.startLast:
+		return 1
+	}
+	return 0
+}
+
+// shutdownCallbacks returns callbacks to run on shutdown of the package,
+// onShutdown first, then late shutdown callbacks in reversed order.
+func (p *pkg) shutdownCallbacks() []Callback {
+	lateL.Lock()
+	defer lateL.Unlock()
+
+	result := make([]Callback, 0, len(p.lateShutdown)+1)
+	if p.onShutdown != nil {
+		result = append(result, p.onShutdown)
+	}
+	for i := len(p.lateShutdown) - 1; i >= 0; i-- {
+		result = append(result, p.lateShutdown[i])
+	}
+	return result
+}
+
+// RegisterOpts contains optional settings of a package, used by
+// RegisterWithOpts.
+type RegisterOpts struct {
+	// Depends are names of depended packages, see Register().
+	Depends []string
+
+	// Priority breaks ties among packages whose dependencies are all started,
+	// lower priority starts first. Packages with equal priority start in
+	// registration order.
+	Priority int
+
+	// Phase groups packages into coarse start stages, all packages of a lower
+	// phase start before any package of a higher phase, and shutdown in
+	// reverse. Depends resolved within phase, a package can not depend on a
+	// package of a higher phase.
+	Phase int
+
+	// StartLast packages start after all other packages regardless of phase,
+	// and shutdown first, such as the package opens the public listener.
+	// Multiple StartLast packages ordered by their depends, phase and
+	// priority. Other packages can not depend on a StartLast package.
+	StartLast bool
+
+	// StartFirst packages start before all other packages regardless of
+	// phase, and shutdown last, such as logging and config. Multiple
+	// StartFirst packages ordered by their depends, phase and priority. A
+	// StartFirst package can only depend on StartFirst packages.
+	//
+	// Start order is decided by, in precedence: StartFirst/StartLast, Phase,
+	// Depends, Priority, then registration order.
+	StartFirst bool
+
+	// Aliases are other names of the package, other packages can depend on
+	// any of them, such as the old name of a renamed package. Aliases must not
+	// collide with names or aliases of other packages, checked in Start().
+	Aliases []string
+
+	// Meta is opaque metadata of the package, such as owner, tier, or docs
+	// link, not used by life, but surfaced by Packages() and Debug().
+	Meta map[string]string
+
+	// ShutdownPriority reorders shutdown of packages have no dependency
+	// relationship in the same phase and StartFirst/StartLast group, lower
+	// shuts down first. Dependencies, StartFirst/StartLast and phases always
+	// win, a package shuts down after all packages depend on it or started
+	// in a later stage, also in concurrent shutdown. Packages of equal
+	// shutdown priority shutdown in reversed start order.
+	ShutdownPriority int
+
+	// Quiet suppresses life's "Starting package" and "Shutdown package" log
+	// lines of the package, such as the package logs its start itself.
+	// Failures are still logged.
+	Quiet bool
 }
 
 // State return current life state.
@@ -94,74 +383,507 @@ func State() StateT {
 	return StateT(atomic.LoadInt32(&lastState))
 }
 
+// 1 if EnsureState() and EnsureStatef() check state, see SetStateChecks()
+var stateChecks int32 = 1
+
+// SetStateChecks set whether EnsureState() and EnsureStatef() check state,
+// default true. Disable to make them no-ops on hot paths of release builds
+// trusting their invariants. State checks inside life package are not
+// affected. Safe to call in any state, from any goroutine.
+func SetStateChecks(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&stateChecks, v)
+}
+
 // EnsureState ensure current state is expected, panic with specific message if
-// failed.
+// failed. No-op if disabled by SetStateChecks().
 func EnsureState(exp StateT, msg string) {
+	if atomic.LoadInt32(&stateChecks) == 0 {
+		return
+	}
 	if State() != exp {
 		log.Panic(msg)
 	}
 }
 
 // EnsureStatef ensure current state is expected, panic with formatted message
-// if failed.
+// if failed. No-op if disabled by SetStateChecks().
 func EnsureStatef(exp StateT, format string, a ...interface{}) {
-	msg := fmt.Sprintf(format, a...)
-	EnsureState(exp, msg)
+	if atomic.LoadInt32(&stateChecks) == 0 {
+		return
+	}
+	ensureStatef(exp, format, a...)
+}
+
+// ensureStatef like EnsureStatef(), but not affected by SetStateChecks(),
+// message formatted only if failed.
+func ensureStatef(exp StateT, format string, a ...interface{}) {
+	if State() != exp {
+		log.Panicf(format, a...)
+	}
+}
+
+// Ready returns true if application is ready to serve, i.e. in Running
+// state and not in pre-shutdown delay. Use it as readiness probe.
+func Ready() bool {
+	return State() == Running && atomic.LoadInt32(&preShutdown) == 0
 }
 
+// Live returns true if application is not halted, unlike Ready() it is true in
+// Draining state. Use it as liveness probe.
+func Live() bool {
+	st := State()
+	return st != Halt && st != Exited
+}
+
+// SetDrainTime set how long to stay in Draining state after OnDrain hooks
+// done, gives load balancer time to notice application not ready. Zero means
+// no wait, Draining state is skipped if no OnDrain hooks either. Can only be
+// called in Initing state.
+func SetDrainTime(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set drain time in \"%v\" state", tag, State())
+	drainTime = d
+}
+
+// SetPreShutdownDelay set how long to wait after a signal received before
+// shutdown starts, Ready() returns false during the wait, gives load balancer
+// time to stop routing new requests, such as endpoints propagation in
+// Kubernetes. Only applies to signal triggered shutdown, another signal
+// received during the wait exits immediately. Can only be called in Initing
+// state.
+func SetPreShutdownDelay(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set pre-shutdown delay in \"%v\" state", tag, State())
+	preShutdownDelay = d
+}
+
+// legalTransitions maps a state to the states it can go to, see the package
+// doc. Exited is not listed, it only set by exit(), from any state.
+var legalTransitions = map[StateT][]StateT{
+	Initing:     {Starting, Halt},
+	Starting:    {Running, Halt},
+	Running:     {Draining, Shutingdown, Halt},
+	Draining:    {Shutingdown, Halt},
+	Shutingdown: {Halt},
+	// reset in test
+	Halt: {Initing},
+}
+
+func legalTransition(from, to StateT) bool {
+	for _, st := range legalTransitions[from] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// setState changes current state, panics if transition from current state to
+// st is illegal. Set to current state is a no-op.
 func setState(st StateT) {
 	// Must called inside `l.Lock()'
+	if state != st && !legalTransition(state, st) {
+		log.Panicf("[%s] Illegal state transition from \"%v\" to \"%v\"", tag, state, st)
+	}
+	enterState(st)
+}
+
+// enterState changes current state without checking.
+func enterState(st StateT) {
+	from := state
 	state = st
 	atomic.StoreInt32(&lastState, int32(st))
+	if from != st {
+		markStateEntered(st)
+		observer.StateChanged(from, st)
+		publishEvent(Event{Kind: EventStateChanged, From: from, To: st})
+	}
+}
+
+var (
+	stateTimesL sync.Mutex
+	// time entering each state, see StateEnteredAt()
+	stateTimes = map[StateT]time.Time{Initing: time.Now()}
+)
+
+func markStateEntered(st StateT) {
+	stateTimesL.Lock()
+	defer stateTimesL.Unlock()
+	stateTimes[st] = time.Now()
+}
+
+// StateEnteredAt returns the time entering specific state, returns false if
+// the state not reached yet. Initing state entered at package initialization.
+// Safe to call from any goroutine.
+func StateEnteredAt(st StateT) (time.Time, bool) {
+	stateTimesL.Lock()
+	defer stateTimesL.Unlock()
+	t, ok := stateTimes[st]
+	return t, ok
 }
 
 // Register a package, optionally includes depended packages. If not provides
 // depended package, it will run as registered order. Depends need not to be
 // exist, it will check and sort in Start().
 func Register(name string, onStart, onShutdown Callback, depends ...string) {
+	RegisterWithOpts(name, onStart, onShutdown, RegisterOpts{Depends: depends})
+}
+
+// RegisterWithOpts register a package like Register(), with more options.
+func RegisterWithOpts(name string, onStart, onShutdown Callback, opts RegisterOpts) {
+	if err := register(&pkgs, name, onStart, onShutdown, opts); err != nil {
+		log.Panicf("[%s] %s", tag, err)
+	}
+}
+
+// RegisterE register a package like Register(), but returns error instead of
+// panic if the registration rejected: not in Initing state, duplicate package
+// name, or package depends on itself.
+func RegisterE(name string, onStart, onShutdown Callback, depends ...string) error {
+	return register(&pkgs, name, onStart, onShutdown, RegisterOpts{Depends: depends})
+}
+
+// AddDepends appends dependencies to a registered package, such as a
+// tracing module adds itself as a dependency of many packages from its own
+// init(). Panics if the package not registered, or depends on itself. Can
+// only be called in Initing state.
+func AddDepends(name string, depends ...string) {
+	ensureStatef(Initing, "[%s] Can not add depends to package \"%s\" in \"%v\" state", tag, name, State())
+	for _, dep := range depends {
+		if dep == name {
+			log.Panicf("[%s] package '%s' depends on itself", tag, name)
+		}
+	}
+
+	infoL.Lock()
+	defer infoL.Unlock()
+	for _, p := range pkgs {
+		if p.name == name {
+			// copy, the slice may shared with the caller of Register()
+			p.depends = append(append([]string(nil), p.depends...), depends...)
+			return
+		}
+	}
+	log.Panicf("[%s] package '%s' not registered", tag, name)
+}
+
+// RegisterAnchor register a package without callbacks, only to order other
+// packages, such as a "storage" package depends on all storage packages,
+// others depend on it. Accepted even if SetRejectNilCallbacks(true).
+func RegisterAnchor(name string, depends ...string) {
+	if err := addPackage(&pkgs, name, nil, nil, RegisterOpts{Depends: depends}); err != nil {
+		log.Panicf("[%s] %s", tag, err)
+	}
+}
+
+// RegisterStart register a start-only package, like Register(name, onStart,
+// nil, depends...).
+func RegisterStart(name string, onStart Callback, depends ...string) {
+	Register(name, onStart, nil, depends...)
+}
+
+// RegisterShutdown register a shutdown-only package, such as removes a lock
+// file, like Register(name, nil, onShutdown, depends...).
+func RegisterShutdown(name string, onShutdown Callback, depends ...string) {
+	Register(name, nil, onShutdown, depends...)
+}
+
+// RegisterSetup register a package whose setup acquires resources and returns
+// the cleanup function releasing them. Setup is called as onStart callback,
+// returned cleanup as onShutdown callback, nil cleanup means nothing to
+// shutdown. Setup returns error is a start failure, as onStart panics.
+func RegisterSetup(name string, setup func() (cleanup func(), err error), depends ...string) {
+	var cleanup func()
+	onStart := func() {
+		var err error
+		if cleanup, err = setup(); err != nil {
+			panic(err)
+		}
+	}
+	onShutdown := func() {
+		if cleanup != nil {
+			cleanup()
+		}
+	}
+	Register(name, onStart, onShutdown, depends...)
+}
+
+// RegisterIf register a package like Register() if enabled, otherwise the
+// package name recorded as disabled, packages depend on it treated as depends
+// on not exist package, see Disabled().
+func RegisterIf(enabled bool, name string, onStart, onShutdown Callback, depends ...string) {
+	if enabled {
+		Register(name, onStart, onShutdown, depends...)
+		return
+	}
+
+	ensureStatef(Initing, "[%s] Can not register package \"%s\" in \"%v\" state", tag, name, State())
+	disabled = append(disabled, name)
+}
+
+// registered returns true if a package of list has name or alias, after
+// normalized.
+func registered(list []*pkg, name string) bool {
+	key := normalizeName(name)
+	for _, p := range list {
+		if normalizeName(p.name) == key {
+			return true
+		}
+		for _, alias := range p.aliases {
+			if normalizeName(alias) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isDisabled(name string) bool {
+	for _, d := range disabled {
+		if normalizeName(d) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// register appends a new package to list, rejects nil callbacks if
+// SetRejectNilCallbacks(true).
+func register(list *[]*pkg, name string, onStart, onShutdown Callback, opts RegisterOpts) error {
+	if rejectNilCallbacks && onStart == nil && onShutdown == nil {
+		return fmt.Errorf("package '%s' has neither onStart nor onShutdown callback, use RegisterAnchor() for ordering only package", name)
+	}
+	return addPackage(list, name, onStart, onShutdown, opts)
+}
+
+// addPackage appends a new package to list.
+func addPackage(list *[]*pkg, name string, onStart, onShutdown Callback, opts RegisterOpts) error {
 	st := State()
 	if st != Initing {
-		log.Panicf("[%s] Can not register package \"%s\" in \"%v\" state", tag, name, st)
+		return fmt.Errorf("Can not register package \"%s\" in \"%v\" state", name, st)
 	}
 
-	for _, p := range pkgs {
+	for _, p := range *list {
 		if p.name == name {
-			log.Panicf("[%s] package '%s' already registered", tag, name)
+			return fmt.Errorf("package '%s' already registered", name)
+		}
+	}
+
+	for _, dep := range opts.Depends {
+		if dep == name {
+			return fmt.Errorf("package '%s' depends on itself", name)
 		}
 	}
-	pkgs = append(pkgs, &pkg{name, onStart, onShutdown, depends})
+
+	if requireRegistered {
+		for _, dep := range opts.Depends {
+			if !registered(*list, dep) {
+				return fmt.Errorf("package '%s' depends on '%s' not registered yet", name, dep)
+			}
+		}
+	}
+
+	if opts.StartFirst && opts.StartLast {
+		return fmt.Errorf("package '%s' can not both StartFirst and StartLast", name)
+	}
+
+	infoL.Lock()
+	defer infoL.Unlock()
+	*list = append(*list, &pkg{
+		name:       name,
+		onStart:    onStart,
+		onShutdown: onShutdown,
+		depends:    opts.Depends,
+		priority:   opts.Priority,
+		phase:      opts.Phase,
+		startFirst: opts.StartFirst,
+		startLast:  opts.StartLast,
+		aliases:    opts.Aliases,
+		meta:       opts.Meta,
+		index:      len(*list),
+		startedCh:  make(chan struct{}),
+
+		shutdownPriority: opts.ShutdownPriority,
+		quiet:            opts.Quiet,
+	})
+	return nil
 }
 
+// rollback shutdown started packages on start failure or cancel, warns
+// packages started without shutdown callback, their resources may leak.
+func rollback(started []*pkg) {
+	var leaks []string
+	for _, p := range started {
+		if p.onStart != nil && len(p.shutdownCallbacks()) == 0 {
+			leaks = append(leaks, p.name)
+		}
+	}
+	if len(leaks) != 0 {
+		warnf("Rollback packages started without onShutdown callback, resources may leak: %s", strings.Join(leaks, ", "))
+	}
+	doShutdownPackages(started)
+}
+
+// startPackage calls onStart callback of p, records and reports its start.
+func startPackage(p *pkg) {
+	if !p.quiet {
+		debugPkgf(p.name, "Starting package %s", p.name)
+	}
+	publishProgress(p.name, PackageStarting)
+	succeed := false
+	defer func() {
+		if !succeed {
+			// onStart callback panics
+			publishProgress(p.name, PackageFailed)
+		}
+	}()
+
+	start := time.Now()
+	if p.onStart != nil {
+		callGuarded(PanicInStart, p.name, p.onStart)
+	}
+	succeed = true
+	d := time.Since(start)
+	infoL.Lock()
+	p.started, p.startDur = true, d
+	infoL.Unlock()
+	close(p.startedCh)
+	observer.PackageStarted(p.name, d)
+	publishEvent(Event{Kind: EventPackageStarted, Name: p.name, Duration: d})
+	publishProgress(p.name, PackageStarted)
+}
+
+// doShutdownPackages shutdown packages in exact reversed order of pkgs, which
+// is the start order, so resources created on start are released in LIFO,
+// unless reordered by shutdown priority. If SetShutdownConcurrency() set,
+// independent packages shutdown in parallel.
 func doShutdownPackages(pkgs []*pkg) {
-	for i := len(pkgs) - 1; i >= 0; i-- {
-		log.Printf("[%s] Shutdown package %s", tag, pkgs[i].name)
-		if pkgs[i].onShutdown != nil {
-			pkgs[i].onShutdown()
+	if shutdownConcurrency > 1 {
+		shutdownConcurrently(pkgs, shutdownConcurrency)
+		return
+	}
+
+	for _, p := range shutdownSequence(pkgs) {
+		shutdownPackage(p)
+	}
+}
+
+// shutdownPackage calls shutdown callbacks of p.
+func shutdownPackage(p *pkg) {
+	if !p.quiet {
+		debugPkgf(p.name, "Shutdown package %s", p.name)
+	}
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			addFailedPkg(p.name)
+			panic(r)
+		}
+	}()
+	for _, fn := range p.shutdownCallbacks() {
+		callGuarded(PanicInShutdown, p.name, fn)
+	}
+	markShutdownDone(p)
+	d := time.Since(start)
+	infoL.Lock()
+	p.stopped, p.stopDur = true, d
+	infoL.Unlock()
+	observer.PackageStopped(p.name, d)
+	publishEvent(Event{Kind: EventPackageStopped, Name: p.name, Duration: d})
+}
+
+// OnShutdownLate adds an extra shutdown callback to a registered package, for
+// resources acquired after start, such as a lazily opened pool. Extra
+// callbacks run after the package's own onShutdown callback, in reversed
+// order of adding. Can only be called in Starting and Running state.
+func OnShutdownLate(name string, fn Callback) {
+	lateL.Lock()
+	defer lateL.Unlock()
+
+	st := State()
+	if st != Starting && st != Running {
+		log.Panicf("[%s] Can not add shutdown callback to package \"%s\" in \"%v\" state", tag, name, st)
+	}
+
+	for _, p := range pkgs {
+		if p.name == name {
+			p.lateShutdown = append(p.lateShutdown, fn)
+			return
 		}
 	}
+	log.Panicf("[%s] package '%s' not registered", tag, name)
+}
+
+// SetShutdownPolicy set what to do if an onShutdown callback panics, default
+// is FailFast. Can only be called in Initing state.
+func SetShutdownPolicy(p ShutdownPolicy) {
+	ensureStatef(Initing, "[%s] Can not set shutdown policy in \"%v\" state", tag, State())
+	shutdownPolicy = p
+}
+
+// ShutdownError returns ErrorList of panics recovered from onShutdown
+// callbacks in BestEffort policy, nil if no error. Must not be called inside
+// callbacks, it waits for the ongoing Shutdown() to complete.
+func ShutdownError() error {
+	lock()
+	defer unlock()
+
+	if len(shutdownErrs) == 0 {
+		return nil
+	}
+	return append(ErrorList(nil), shutdownErrs...)
 }
 
 // Start put state to starting, Run all registered OnStart() functions, if all
 // succeed, move to running state.
 // If any OnStart function panic, shutdown all started packages.
+//
+// When Start() returns, all background goroutines of life, such as signal
+// monitor and ShutdownOn() watchers, are established.
 func Start() {
+	start(context.Background())
+}
+
+// StartContext like Start(), but ctx governs the start: if ctx done before
+// all packages started, no more package starts, started packages are
+// shutdown, state goes to Halt, and returns ctx.Err(). Unlike cancelled by
+// signal, the process not exit, the caller decides what to do. Such as bound
+// the start time by the context of a test. See also StartingContext().
+func StartContext(ctx context.Context) error {
+	return start(ctx)
+}
+
+func start(ctx context.Context) error {
 	startedPkgs := 0
-	l.Lock()
+	// package whose onStart callback is running
+	var starting *pkg
+	// true if reached Running state, runs OnRunning functions after unlock
+	running := false
+	defer func() {
+		if running {
+			callOnRunning()
+		}
+	}()
+	lock()
 	defer func() {
-		l.Unlock()
+		unlock()
 		if err := recover(); err != nil {
 			// stop started packages
-			l.Lock()
-			defer l.Unlock()
+			lock()
+			defer unlock()
 
+			if starting != nil {
+				warnPkgf(starting.name, "Started %d of %d packages before failing on '%s', shutdown all started packages", startedPkgs, len(pkgs), starting.name)
+			}
 			if startedPkgs > 0 {
-				log.Printf("[%s] Error in starting package %s, shutdown all started packages", tag, pkgs[startedPkgs-1].name)
-				doShutdownPackages(pkgs[:startedPkgs])
+				rollback(pkgs[:startedPkgs])
 			}
 
-			errors.Handle(nil, err)
-			callHooks(OnAbort)
-			hal.Exit(10)
+			setShutdownCause(CauseStartFailure, nil)
+			errorHandler(nil, err)
+			exitWith(StartFailedExitCode, toError(err))
 			panic(err)
 		}
 	}()
@@ -170,199 +892,1050 @@ func Start() {
 		log.Panicf("[%s] Can not start in \"%v\" state", tag, state)
 	}
 
+	defer close(progress)
+
+	if startDeadline > 0 {
+		watchdog := time.AfterFunc(startDeadline, startTimeout)
+		defer watchdog.Stop()
+	}
+
 	callHooks(BeforeStarting)
 	setState(Starting)
+	beginStart(ctx)
+	defer endStart()
 
-	pkgs = sortByDependency(pkgs)
+	var ready sync.WaitGroup
+	if signalHandling {
+		// monitor signal before starting packages, a signal received during
+		// start cancels the start.
+		launchSignalMonitor(&ready, shutdown)
+		ready.Wait()
+	}
+
+	// cancelled rollbacks started packages, then returns the error of ctx if
+	// cancelled by ctx, otherwise exit.
+	cancelled := func() error {
+		setShutdownCause(CauseStartFailure, nil)
+		logf("Start cancelled, shutdown all started packages")
+		rollback(pkgs[:startedPkgs])
+		setState(Halt)
+		close(shutdown)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		exit(1)
+		return nil
+	}
+
+	sorted, err := sortByDependency(pkgs)
+	if err != nil {
+		log.Panicf("[%s] %s", tag, err)
+	}
+	infoL.Lock()
+	pkgs = sorted
+	infoL.Unlock()
 	for i, pkg := range pkgs {
-		log.Printf("[%s] Starting package %s", tag, pkg.name)
-		if pkg.onStart != nil {
-			pkg.onStart()
+		if isStartCancelled() || ctx.Err() != nil {
+			return cancelled()
 		}
+
+		starting = pkg
+		startPackage(pkg)
+		starting = nil
 		startedPkgs = i + 1
+		infoL.Lock()
+		startedCount = startedPkgs
+		infoL.Unlock()
+	}
+	if endStart() || ctx.Err() != nil {
+		return cancelled()
 	}
 
 	callHooks(BeforeRunning)
-	log.Printf("[%s] all packages started, ready to serve", tag)
+	logf("all packages started, ready to serve")
 	setState(Running)
+	atomic.StoreInt64(&runningSince, time.Now().UnixNano())
+
+	// arguments of watchers evaluated here, not in the goroutines
+	done := shutdown
+	ready.Add(len(shutdownOn))
+	for _, ch := range shutdownOn {
+		ch := ch
+		goBackground(func() { watchShutdown(ch, done, &ready) })
+	}
+
+	if isIdle != nil {
+		ready.Add(1)
+		d, idle, clk := idleTimeout, isIdle, clock
+		goBackground(func() { watchIdle(clk, d, idle, done, &ready) })
+	}
+
+	if reExecSignal != nil && !reset.TestMode() {
+		ready.Add(1)
+		sig := reExecSignal
+		goBackground(func() { watchReExec(sig, done, &ready) })
+	}
+
+	if reloadSignal != nil && !reset.TestMode() {
+		ready.Add(1)
+		sig := reloadSignal
+		goBackground(func() { watchReload(sig, done, &ready) })
+	}
+
+	// Background goroutines are established when Start() returns, no window
+	// that Running but signal not monitored.
+	ready.Wait()
+	running = true
+	return nil
+}
+
+// functions registered by OnRunning()
+var onRunning []func()
+
+// OnRunning register fn to run after entering Running state, in registration
+// order, before Start() returns. Unlike BeforeRunning hooks, fn never runs if
+// start failed, such as register to service discovery only on successful
+// boot. fn runs without internal lock held, can call Shutdown(). Can only be
+// called in Initing state.
+func OnRunning(fn func()) {
+	ensureStatef(Initing, "[%s] Can not register OnRunning function in \"%v\" state", tag, State())
+	onRunning = append(onRunning, fn)
+}
 
-	if !reset.TestMode() {
-		go monitorSignal()
+func callOnRunning() {
+	for _, fn := range onRunning {
+		fn()
+	}
+}
+
+// beginStart marks start in progress, can be cancelled by cancelStart(),
+// creates the start context from ctx.
+func beginStart(ctx context.Context) {
+	startCancelL.Lock()
+	defer startCancelL.Unlock()
+	inStart, startCancelled = true, false
+	startCtx, startCtxCancel = context.WithCancel(ctx)
+}
+
+// endStart marks start no longer in progress, returns true if cancelled.
+func endStart() bool {
+	startCancelL.Lock()
+	defer startCancelL.Unlock()
+	inStart = false
+	startCtxCancel()
+	return startCancelled
+}
+
+// cancelStart cancels start in progress, returns false if not in start.
+func cancelStart() bool {
+	startCancelL.Lock()
+	defer startCancelL.Unlock()
+	if !inStart {
+		return false
+	}
+	startCancelled = true
+	startCtxCancel()
+	return true
+}
+
+// StartingContext returns the context of current start, derived from the
+// context of StartContext(), also done if start cancelled by signal, or start
+// complete. onStart callbacks use it to bound blocking work, such as dial a
+// database. Returns context.Background() before start.
+func StartingContext() context.Context {
+	startCancelL.Lock()
+	defer startCancelL.Unlock()
+	return startCtx
+}
+
+func isStartCancelled() bool {
+	startCancelL.Lock()
+	defer startCancelL.Unlock()
+	return startCancelled
+}
+
+// SetSignalHandling enable or disable monitoring of SIGINT and SIGTERM signals
+// to shutdown, enabled by default. Disable it if signals handled by the host,
+// such as embedded in a larger application, then the host should call
+// Shutdown() by itself. Can only be called in Initing state.
+func SetSignalHandling(enabled bool) {
+	ensureStatef(Initing, "[%s] Can not set signal handling in \"%v\" state", tag, State())
+	signalHandling = enabled
+}
+
+// SetExitHandling enable or disable exiting the process by life, enabled by
+// default. If disabled, on start or shutdown failure, Abort() and Exit(),
+// life goes to Exited state and records the exit code, but leaves the process
+// running, the caller owns the process exit. Start() and Shutdown() still
+// re-panic the failure after the exit code recorded, except shutdown failures
+// in BestEffort policy, recover it to reach the exit, such as:
+//
+//	life.SetExitHandling(false)
+//	...
+//	func() {
+//		defer func() {
+//			if err := recover(); err != nil {
+//				log.Print(err)
+//			}
+//		}()
+//		life.Start()
+//		life.WaitToEnd()
+//	}()
+//	os.Exit(life.ExitCode())
+//
+// Can only be called in Initing state.
+func SetExitHandling(enabled bool) {
+	ensureStatef(Initing, "[%s] Can not set exit handling in \"%v\" state", tag, State())
+	exitHandling = enabled
+}
+
+// SetErrorHandler set the function to report panics recovered from onStart
+// and onShutdown callbacks, default to errors.Handle(). Can only be called in
+// Initing state.
+func SetErrorHandler(h func(context.Context, interface{})) {
+	ensureStatef(Initing, "[%s] Can not set error handler in \"%v\" state", tag, State())
+	errorHandler = h
+}
+
+// SetStartDeadline set the max duration of Start(), if exceeded, stacks of all
+// goroutines are logged to find out the hung callback, then abort with exit
+// code 10. Zero means no limit, the default. Can only be called in Initing
+// state.
+func SetStartDeadline(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set start deadline in \"%v\" state", tag, State())
+	startDeadline = d
+}
+
+func startTimeout() {
+	warnf("Start not complete in %v, goroutine stacks:\n%s", startDeadline, allStacks())
+	exitWith(StartFailedExitCode, fmt.Errorf("start not complete in %v", startDeadline))
+}
+
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// ShutdownOn register a channel, closing it triggers Shutdown(). Such as a
+// "lost leadership" channel of leader election. Channel is watched after
+// Start() succeed, and the watch stops if shutdown by other reasons. Can only
+// be called in Initing state.
+func ShutdownOn(ch <-chan struct{}) {
+	ensureStatef(Initing, "[%s] Can not register shutdown channel in \"%v\" state", tag, State())
+	shutdownOn = append(shutdownOn, ch)
+}
+
+func watchShutdown(ch, done <-chan struct{}, ready *sync.WaitGroup) {
+	ready.Done()
+	select {
+	case <-ch:
+		logf("Shutdown channel closed, start shutdown")
+		setShutdownCause(CauseChannel, nil)
+		Shutdown()
+	case <-done:
 	}
 }
 
 // Shutdown put state to shutdown, Run all registered OnShutdown() function in
-// reserved order.
+// exact reversed start order.
+//
+// Shutdown before Start() puts state to Halt without calling any callbacks
+// and hooks, WaitToEnd() returns immediately, and Start() is no longer allowed.
 func Shutdown() {
-	l.Lock()
+	setShutdownCause(CauseProgrammatic, nil)
+	lock()
 	defer func() {
 		// always set exit state to halt
 		setState(Halt)
-		l.Unlock()
+		unlock()
 
 		if err := recover(); err != nil {
-			errors.Handle(nil, err)
-			callHooks(OnAbort)
-			hal.Exit(11)
+			errorHandler(nil, err)
+			exitWith(ShutdownFailedExitCode, toError(err))
 			panic(err)
 		}
 	}()
 
 	switch state {
 	case Running:
-	case Shutingdown:
-		log.Fatalf("[%s] corrupt internal state: %v", tag, state)
+	case Initing:
+		// Shutdown before start, no package to shutdown, go to Halt state
+		// directly, and release WaitToEnd() callers.
+		logf("Shutdown before start")
+		close(shutdown)
+		return
+	case Draining, Shutingdown:
+		// recovered by the defer above, which runs OnAbort hooks and exit
+		log.Panicf("[%s] corrupt internal state: %v", tag, state)
 	default:
 		// app can shutdown at any state
 		return
 	}
 
+	// skip packages shutdown by ShutdownPackage()
+	running := startedPackages(pkgs)
+	defer beginShutdownBudget()()
+	defer warnSlowShutdown(running)()
+	waitGates()
+
+	if drainTime > 0 || len(hooks[OnDrain]) != 0 {
+		setState(Draining)
+		callHooks(OnDrain)
+		if drainTime > 0 {
+			logf("Draining, wait %v", drainTime)
+			time.Sleep(budgetTimeout(drainTime))
+		}
+	}
+	waitInFlight()
+
 	setState(Shutingdown)
 
 	callHooks(BeforeShutingdown)
-	doShutdownPackages(pkgs)
+	doShutdownPackages(running)
 
-	log.Printf("[%s] all packages shutdown, ready to exit", tag)
+	if len(shutdownErrs) != 0 {
+		warnf("%d packages failed to shutdown", len(shutdownErrs))
+		recordExitCode(ShutdownFailedExitCode)
+	}
+	callHooks(AfterShutdown)
+	logf("all packages shutdown, ready to exit")
+	if len(shutdownErrs) == 0 {
+		logShutdownSummary()
+	}
 	close(shutdown)
 }
 
+// ShutdownOutcome is the result of ShutdownAndWait().
+type ShutdownOutcome struct {
+	// Err is the ErrorList of failed onShutdown callbacks in BestEffort
+	// policy, see ShutdownError(). Nil if all succeed.
+	Err error
+
+	// Duration from the beginning of draining or shutingdown to halt, zero if
+	// shutdown before start.
+	Duration time.Duration
+}
+
+// ShutdownAndWait calls Shutdown(), and returns after shutdown completely
+// done, even if the shutdown triggered by another goroutine, such as by
+// signal. Like Shutdown(), panics if onShutdown callback panics in FailFast
+// policy.
+func ShutdownAndWait() ShutdownOutcome {
+	Shutdown()
+	WaitToEnd()
+
+	var r ShutdownOutcome
+	r.Err = ShutdownError()
+	halt, _ := StateEnteredAt(Halt)
+	begin, ok := StateEnteredAt(Draining)
+	if !ok {
+		begin, ok = StateEnteredAt(Shutingdown)
+	}
+	if ok {
+		r.Duration = halt.Sub(begin)
+	}
+	return r
+}
+
+// SetShutdownTimeout set max duration of shutdown, default 60 seconds. It
+// bounds the wait of shutdown gates, and shutdown triggered by signal. Can
+// only be called in Initing state.
+func SetShutdownTimeout(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set shutdown timeout in \"%v\" state", tag, State())
+	shutdownTimeout = d
+}
+
+// RegisterShutdownGate register a gate that can delay shutdown. At the
+// beginning of Shutdown(), all gates are polled, if any returns false,
+// shutdown waits and re-polls until all gates return true, or shutdown
+// timeout exceeded. Use it to block shutdown until a safe point, such as a
+// checkpoint written. Name is used in log only. Can only be called in Initing
+// state.
+func RegisterShutdownGate(name string, fn func() bool) {
+	ensureStatef(Initing, "[%s] Can not register shutdown gate \"%s\" in \"%v\" state", tag, name, State())
+	gates = append(gates, &gate{name, fn})
+}
+
+func waitGates() {
+	deadline := time.Now().Add(budgetTimeout(shutdownTimeout))
+	for {
+		var closed []string
+		for _, g := range gates {
+			if !g.fn() {
+				closed = append(closed, g.name)
+			}
+		}
+		if len(closed) == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			warnf("Shutdown gates timeout: %s", strings.Join(closed, ", "))
+			setGateTimeout()
+			return
+		}
+		time.Sleep(gatePollInterval)
+	}
+}
+
 // Abort calling Abort hooks, and then exit. It is useful when fatal error
 // occurred outside life package, ensure abort hooks done its job
 // (such as: spork/errrpt, async log).
 func Abort() {
-	Exit(12)
+	Exit(AbortExitCode)
+}
+
+// AbortWith like Abort(), err is the cause of abort passed to abort hooks
+// registered by RegisterAbortHook().
+func AbortWith(err error) {
+	exitWith(AbortExitCode, err)
 }
 
 // Exit the problem with n as exit code after executing all OnAbort
-// hooks. Like Abort() but can set exit code.
+// hooks. Like Abort() but can set exit code. OnAbort hooks are skipped if
+// already shutdown, see SetAlwaysRunAbortHooks().
+//
+// Only the first exit by Exit(), Abort(), AbortWith(), or failure of start
+// and shutdown takes effect, its exit code wins, OnAbort hooks run at most
+// once. Other calls, such as from goroutines of concurrent fatal errors, wait
+// the first one done and return.
 func Exit(n int) {
-	if State() != Halt || n == 12 {
-		callHooks(OnAbort)
+	exitWith(n, nil)
+}
+
+var (
+	exitL sync.Mutex
+	// closed when the first exitWith() done, nil if not called yet
+	exitDone chan struct{}
+	// goroutine running the first exitWith()
+	exitOwner int64
+)
+
+// exitWith runs OnAbort hooks with cause, then exit with code n. Hooks are
+// skipped if cause is nil and shouldRunAbortHooks(n) false. Only the first
+// call takes effect, see Exit().
+func exitWith(n int, cause error) {
+	id := goid()
+	exitL.Lock()
+	if exitDone != nil {
+		done, owner := exitDone, exitOwner
+		exitL.Unlock()
+		// called by OnAbort hook, wait would dead-lock
+		if owner != id {
+			<-done
+		}
+		return
+	}
+	done := make(chan struct{})
+	exitDone, exitOwner = done, id
+	exitL.Unlock()
+	defer close(done)
+
+	if cause != nil || shouldRunAbortHooks(n) {
+		callAbortHooks(cause)
+	}
+	exit(n)
+}
+
+// SetAlwaysRunAbortHooks set whether to run OnAbort hooks on exit after
+// shutdown. By default, if application already shutdown (Halt or Exited
+// state), Exit() skips OnAbort hooks, because resources they touch may be
+// released, but Abort() and AbortWith() (exit code AbortExitCode) still run
+// them, they are explicit requests to abort. Set to true to run OnAbort hooks
+// on every exit. Can only be called in Initing state.
+func SetAlwaysRunAbortHooks(always bool) {
+	ensureStatef(Initing, "[%s] Can not set always run abort hooks in \"%v\" state", tag, State())
+	alwaysRunAbortHooks = always
+}
+
+// shouldRunAbortHooks returns true if OnAbort hooks should run on exit with
+// code n, see SetAlwaysRunAbortHooks().
+func shouldRunAbortHooks(n int) bool {
+	if alwaysRunAbortHooks || n == AbortExitCode {
+		return true
+	}
+
+	st := State()
+	return st != Halt && st != Exited
+}
+
+// toError converts recovered value to error.
+func toError(v interface{}) error {
+	if err, ok := v.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", v)
+}
+
+// exit set state to Exited, then exit the process with code n.
+func exit(n int) {
+	// Only lastState updated, may not hold `l' here, `state' keeps the last
+	// state before exit.
+	if from := StateT(atomic.SwapInt32(&lastState, int32(Exited))); from != Exited {
+		markStateEntered(Exited)
+		observer.StateChanged(from, Exited)
+		publishEvent(Event{Kind: EventStateChanged, From: from, To: Exited})
+	}
+	atomic.StoreInt32(&exitCode, int32(n))
+	if !exitHandling {
+		return
+	}
+	if n != 0 {
+		throttleExit()
 	}
 	hal.Exit(n)
 }
 
+// recordExitCode records n as exit code if no failure recorded yet, for the
+// outcome decided without exiting, such as shutdown failed in BestEffort
+// policy.
+func recordExitCode(n int) {
+	atomic.CompareAndSwapInt32(&exitCode, 0, int32(n))
+}
+
+// SetMinRuntime set the min duration the process runs after entering Running
+// state, before it exits abnormally. If the process aborts early, exit delayed
+// to throttle restart storms, such as Kubernetes crash loop. Zero, the
+// default, disables throttling. Can only be called in Initing state.
+func SetMinRuntime(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set min runtime in \"%v\" state", tag, State())
+	minRuntime = d
+}
+
+func throttleExit() {
+	since := atomic.LoadInt64(&runningSince)
+	if minRuntime <= 0 || since == 0 {
+		return
+	}
+
+	if d := minRuntime - time.Since(time.Unix(0, since)); d > 0 {
+		logf("Exit too early, throttling, sleep %v", d)
+		time.Sleep(d)
+	}
+}
+
+// Generation returns a number increased on each reset, in test mode. Values
+// derived from life, such as the result of StartProgress(), are stale if the
+// generation changed.
+func Generation() uint64 {
+	return atomic.LoadUint64(&generation)
+}
+
+// ExitCode returns the exit code of the process given the outcome so far: 0
+// if nothing failed, StartFailedExitCode, ShutdownFailedExitCode (also if
+// packages failed in BestEffort policy), AbortExitCode, or the code passed to
+// Exit(). See SetExitHandling() to exit the process by the caller.
+func ExitCode() int {
+	return int(atomic.LoadInt32(&exitCode))
+}
+
 // WaitToEnd block calling goroutine until safely Shutdown. Can only be called
-// in running and afterwards state.
+// in running and afterwards state. Panics if called inside onStart or
+// onShutdown callbacks, it would dead-lock otherwise.
 func WaitToEnd() {
-	l.Lock()
+	if atomic.LoadInt64(&lockOwner) == goid() {
+		if State() == Starting {
+			log.Panicf("[%s] WaitToEnd called during startup", tag)
+		}
+		log.Panicf("[%s] WaitToEnd called during shutdown", tag)
+	}
+
+	lock()
 
 	switch state {
 	case Halt:
 	case Running, Starting, Initing:
-		l.Unlock()
+		unlock()
+		atomic.AddInt32(&waiters, 1)
+		defer atomic.AddInt32(&waiters, -1)
 		<-shutdown
 		return
 	default:
-		// Shutingdown can not visible, it is only in Shutdown function
-		log.Fatalf("[%s] Unknown state: %v", tag, state)
+		// Draining and Shutingdown can not visible, they are only in Shutdown function
+		err := fmt.Errorf("corrupt internal state: %v", state)
+		unlock()
+		AbortWith(err)
+		log.Panicf("[%s] %s", tag, err)
 	}
 
+	unlock()
+}
+
+// number of goroutines blocked in WaitToEnd()
+var waiters int32
+
+// WaitersCount returns number of goroutines blocked in WaitToEnd(), to find
+// the goroutine not returned from its wait if the process not exit after
+// shutdown.
+func WaitersCount() int {
+	return int(atomic.LoadInt32(&waiters))
+}
+
+func lock() {
+	l.Lock()
+	atomic.StoreInt64(&lockOwner, goid())
+}
+
+func unlock() {
+	atomic.StoreInt64(&lockOwner, 0)
 	l.Unlock()
 }
 
-func sortByDependency(pkgs []*pkg) []*pkg {
-	graph := topsort.NewGraph()
-	pkgMap := make(map[string]*pkg, len(pkgs))
+// goid returns id of current goroutine, parsed from the first line of stack
+// trace, such as: "goroutine 18 [running]:".
+func goid() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	id, _ := strconv.ParseInt(strings.Fields(string(buf[:n]))[1], 10, 64)
+	return id
+}
+
+// SetStrictDependencies set whether depends on not exist package is an error.
+// Default false, only a warning logged, keeps production flexible; enable it
+// in tests to catch wiring typos, Start() panics on missing dependency. Can
+// only be called in Initing state.
+func SetStrictDependencies(strict bool) {
+	ensureStatef(Initing, "[%s] Can not set strict dependencies in \"%v\" state", tag, State())
+	strictDependencies = strict
+}
+
+// SetRequireRegisteredDependencies set whether a package can only depend on
+// packages already registered, Register() panics otherwise. Enforces the
+// wiring files registering packages in dependency order. Default false,
+// dependencies resolved at Start(). Can only be called in Initing state.
+func SetRequireRegisteredDependencies(required bool) {
+	ensureStatef(Initing, "[%s] Can not set require registered dependencies in \"%v\" state", tag, State())
+	requireRegistered = required
+}
+
+// SetRejectNilCallbacks set whether Register() rejects package having both
+// onStart and onShutdown nil, to catch an accidental Register("x", nil, nil)
+// meant to have callbacks. Default false. Register ordering only packages by
+// RegisterAnchor(). Can only be called in Initing state.
+func SetRejectNilCallbacks(reject bool) {
+	ensureStatef(Initing, "[%s] Can not set reject nil callbacks in \"%v\" state", tag, State())
+	rejectNilCallbacks = reject
+}
+
+// SetNameNormalizer set a function to normalize package names and dependency
+// references before sorting packages, such as strings.ToLower to make
+// dependency case-insensitive. Default nil, match names exactly. Can only be
+// called in Initing state.
+func SetNameNormalizer(fn func(string) string) {
+	ensureStatef(Initing, "[%s] Can not set name normalizer in \"%v\" state", tag, State())
+	nameNormalizer = fn
+}
+
+func normalizeName(name string) string {
+	if nameNormalizer == nil {
+		return name
+	}
+	return nameNormalizer(name)
+}
+
+// sortByDependency sorts packages in dependency order. Among packages whose
+// dependencies are all sorted, the one with lower priority goes first, ties
+// broken by registration order.
+func sortByDependency(pkgs []*pkg) ([]*pkg, error) {
+	sorted, errs := checkAndSort(pkgs)
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+	return sorted, nil
+}
 
+// checkAndSort does the work of sortByDependency(), but not stop on the first
+// problem, returns all problems found. Sorted result is undefined if any
+// problem found.
+func checkAndSort(pkgs []*pkg) ([]*pkg, ErrorList) {
+	var problems ErrorList
+	g, errs := newDepGraph(pkgs, func(p *pkg, name string, dep *pkg) bool {
+		if dep == nil {
+			reason := "not exist"
+			if isDisabled(name) {
+				reason = "disabled"
+			}
+			if strictDependencies {
+				problems = append(problems, fmt.Errorf("\"%s\" depends on %s package \"%s\"", p.name, reason, name))
+				return false
+			}
+			warnPkgf(p.name, "Warning: \"%s\" depends on %s package \"%s\"", p.name, reason, name)
+			return false
+		}
+		if dep.rank() > p.rank() {
+			if dep.startLast {
+				problems = append(problems, fmt.Errorf("\"%s\" depends on \"%s\" that starts last", p.name, dep.name))
+			} else {
+				problems = append(problems, fmt.Errorf("\"%s\" starts first, but depends on \"%s\" that not", p.name, dep.name))
+			}
+		} else if dep.rank() == p.rank() && dep.phase > p.phase {
+			problems = append(problems, fmt.Errorf("\"%s\" of phase %d depends on \"%s\" of higher phase %d", p.name, p.phase, dep.name, dep.phase))
+		}
+		return true
+	})
+	errs = append(errs, problems...)
+
+	result, cycle := g.sort(pkgs)
+	if cycle != nil {
+		errs = append(errs, cycle)
+	}
+	return result, errs
+}
+
+// depGraph is the dependency graph of packages, shared by Start(),
+// Validate() and CheckCycles().
+type depGraph struct {
+	// packages by normalized name and alias
+	pkgMap map[string]*pkg
+
+	// number of unsorted depended packages of each package
+	waiting map[*pkg]int
+
+	// packages depend on each package
+	dependents map[*pkg][]*pkg
+}
+
+// newDepGraph builds the dependency graph of pkgs, returns name and alias
+// collisions, the first registered one wins. visit called for each
+// dependency if not nil, dep is nil if not found, returns false to drop the
+// dependency. Dependencies not found always dropped.
+func newDepGraph(pkgs []*pkg, visit func(p *pkg, name string, dep *pkg) bool) (*depGraph, ErrorList) {
+	var errs ErrorList
+	g := &depGraph{
+		pkgMap:     make(map[string]*pkg, len(pkgs)),
+		waiting:    make(map[*pkg]int, len(pkgs)),
+		dependents: make(map[*pkg][]*pkg, len(pkgs)),
+	}
 	for _, p := range pkgs {
-		pkgMap[p.name] = p
-		graph.AddNode(p.name)
+		key := normalizeName(p.name)
+		if dup, exist := g.pkgMap[key]; exist {
+			errs = append(errs, fmt.Errorf("package '%s' and '%s' have the same normalized name '%s'", dup.name, p.name, key))
+			continue
+		}
+		g.pkgMap[key] = p
+	}
+	for _, p := range pkgs {
+		for _, alias := range p.aliases {
+			key := normalizeName(alias)
+			if dup, exist := g.pkgMap[key]; exist {
+				errs = append(errs, fmt.Errorf("alias '%s' of package '%s' collides with package '%s'", alias, p.name, dup.name))
+				continue
+			}
+			g.pkgMap[key] = p
+		}
 	}
 
 	for _, p := range pkgs {
 		for _, name := range p.depends {
-			if _, exist := pkgMap[name]; !exist {
-				log.Printf("[%s] Warning: \"%s\" depends on not exist package \"%s\"", tag, p.name, name)
+			name = normalizeName(name)
+			dep := g.pkgMap[name]
+			if visit != nil && !visit(p, name, dep) || dep == nil {
 				continue
 			}
-			if err := graph.AddEdge(p.name, name); err != nil {
-				log.Panicf("[%s] Dependency failed: %s", tag, err)
-			}
+			g.waiting[p]++
+			g.dependents[dep] = append(g.dependents[dep], p)
 		}
 	}
+	return g, errs
+}
 
-	sortedPkgNames := doSort(graph)
-	if len(sortedPkgNames) != len(pkgs) {
-		msg := ""
-		for _, p := range pkgs {
-			if len(p.depends) != 0 {
-				msg += fmt.Sprintf("\n\t%s -> %s", p.name, strings.Join(p.depends, ", "))
-			}
+// sort returns pkgs in dependency order, ties broken by nextReady(). Returns
+// *CycleError if loop dependency found, the result is partial then. Can only
+// be called once.
+func (g *depGraph) sort(pkgs []*pkg) ([]*pkg, *CycleError) {
+	ready := make([]*pkg, 0, len(pkgs))
+	for _, p := range pkgs {
+		if g.waiting[p] == 0 {
+			ready = append(ready, p)
 		}
-		log.Panicf("[%s] Loop dependency detected%s", tag, msg)
 	}
 
 	result := make([]*pkg, 0, len(pkgs))
-	for _, pkgName := range sortedPkgNames {
-		result = append(result, pkgMap[pkgName])
+	for len(ready) > 0 {
+		i := nextReady(ready)
+		p := ready[i]
+		ready = append(ready[:i], ready[i+1:]...)
+		result = append(result, p)
+
+		for _, d := range g.dependents[p] {
+			g.waiting[d]--
+			if g.waiting[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
 	}
 
-	return result
+	if len(result) != len(pkgs) {
+		return result, g.cycleError(pkgs)
+	}
+	return result, nil
 }
 
-func doSort(g *topsort.Graph) []string {
-	result := make([]string, 0, len(pkgs))
-	added := make(map[string]bool, len(pkgs))
+// Validate checks registered packages without starting them, returns
+// ErrorList of all problems found, such as loop dependency, packages have
+// the same normalized name, depends on higher phase, and depends on not
+// exist package if SetStrictDependencies(true). Returns nil if no problem.
+// Other mistakes, such as register package or hook in wrong state, already
+// panic at the time of registration. Can only be called in Initing state.
+func Validate() error {
+	ensureStatef(Initing, "[%s] Can not validate in \"%v\" state", tag, State())
+	if _, errs := checkAndSort(pkgs); len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// CheckCycles checks registered packages for loop dependency only, returns
+// *CycleError if found, otherwise nil. Lighter than Validate(), no other
+// problem is checked or logged. Safe to call in any state.
+func CheckCycles() error {
+	infoL.Lock()
+	list := append([]*pkg(nil), pkgs...)
+	infoL.Unlock()
+
+	g, _ := newDepGraph(list, nil)
+	if _, cycle := g.sort(list); cycle != nil {
+		return cycle
+	}
+	return nil
+}
+
+// CycleError returned if packages have loop dependency.
+type CycleError struct {
+	// Cycle is package names in the loop, each package depends on the next
+	// one, the first and the last are the same package, such as:
+	// ["a", "b", "a"].
+	Cycle []string
+
+	msg string
+}
+
+func (e *CycleError) Error() string {
+	return "Loop dependency detected" + e.msg
+}
+
+// cycleError creates CycleError from unsorted packages after sort(),
+// waiting tells packages blocked by the loop.
+func (g *depGraph) cycleError(pkgs []*pkg) *CycleError {
+	msg := ""
 	for _, p := range pkgs {
-		if noIncoming(pkgs, p) {
-			depends, err := g.TopSort(p.name)
-			if err != nil {
-				log.Panicf("[%s] %v", tag, err)
-			}
+		if len(p.depends) != 0 {
+			msg += fmt.Sprintf("\n\t%s -> %s", p.name, strings.Join(p.depends, ", "))
+		}
+	}
 
-			for _, p := range depends {
-				if !added[p] {
-					result = append(result, p)
-					added[p] = true
-				}
-			}
+	var p *pkg
+	for _, p = range pkgs {
+		if g.waiting[p] != 0 {
+			break
 		}
 	}
 
-	return result
-}
+	// Each blocked package has at least one blocked dependency, follow them
+	// until come back to a visited one.
+	visited := map[*pkg]int{}
+	var path []string
+	for {
+		if i, ok := visited[p]; ok {
+			return &CycleError{append(path[i:], p.name), msg}
+		}
+		visited[p] = len(path)
+		path = append(path, p.name)
 
-func noIncoming(pkgs []*pkg, p *pkg) bool {
-	for _, v := range pkgs {
-		for _, pkgName := range v.depends {
-			if p.name == pkgName {
-				return false
+		for _, name := range p.depends {
+			if dep, exist := g.pkgMap[normalizeName(name)]; exist && g.waiting[dep] != 0 {
+				p = dep
+				break
 			}
 		}
 	}
-	return true
+}
+
+// nextReady returns the index of the package in ready that should go first.
+func nextReady(ready []*pkg) int {
+	r := 0
+	for i, p := range ready[1:] {
+		if startsBefore(p, ready[r]) {
+			r = i + 1
+		}
+	}
+	return r
+}
+
+// startsBefore compares by rank, phase, priority, then registration order.
+func startsBefore(p, q *pkg) bool {
+	if p.rank() != q.rank() {
+		return p.rank() < q.rank()
+	}
+	if p.phase != q.phase {
+		return p.phase < q.phase
+	}
+	if p.priority != q.priority {
+		return p.priority < q.priority
+	}
+	return p.index < q.index
 }
 
 func init() {
 	reset.Register(Shutdown, func() {
-		setState(Initing)
-		pkgs = pkgs[:0]
-		hooks = make([][]*hook, 4)
-		shutdown = make(chan struct{})
+		resetConfig()
+		resetState()
 	})
 }
 
-func monitorSignal() {
+// resetConfig restores all configurable options to their defaults. Every new
+// option must be restored here, otherwise it leaks from one test to another.
+func resetConfig() {
+	observer = nopObserver{}
+	drainTime = 0
+	preShutdownDelay = 0
+	shutdownOn = nil
+	shutdownPolicy = FailFast
+	nameNormalizer = nil
+	startDeadline = 0
+	shutdownTimeout = defaultShutdownTimeout
+	logFormat = Human
+	logLevel = LogDebug
+	strictDependencies = false
+	requireRegistered = false
+	rejectNilCallbacks = false
+	minRuntime = 0
+	signalHandling = true
+	atomic.StoreInt32(&stateChecks, 1)
+	exitHandling = true
+	errorHandler = errors.Handle
+	alwaysRunAbortHooks = false
+	shutdownConcurrency = 1
+	shutdownBudget = 0
+	panicPolicy = nil
+	callbackMiddleware = nil
+	clock = realClock{}
+	shutdownWarnRatio = defaultShutdownWarnRatio
+	reExecSignal = nil
+	reloadSignal = nil
+	healthCheckTimeout = defaultHealthCheckTimeout
+	eventBufferSize = defaultEventBufferSize
+	tag = defaultTag
+}
+
+// resetState clears registered packages and hooks, and go back to Initing
+// state.
+func resetState() {
+	atomic.AddUint64(&generation, 1)
+	setState(Initing)
+	stateTimesL.Lock()
+	stateTimes = map[StateT]time.Time{Initing: time.Now()}
+	stateTimesL.Unlock()
+	infoL.Lock()
+	pkgs = pkgs[:0]
+	hooks = make([][]*hook, numHookTypes)
+	startedCount = 0
+	infoL.Unlock()
+	disabled = nil
+	reExecListener = nil
+	timingsL.Lock()
+	hookTimings = make([][]HookTiming, numHookTypes)
+	lastTimeout = nil
+	timingsL.Unlock()
+	shutdown = make(chan struct{})
+	shutdownErrs = nil
+	progress = make(chan StartEvent, eventBufferSize)
+	gates = nil
+	reloaders = nil
+	onRunning = nil
+	exitL.Lock()
+	exitDone = nil
+	exitL.Unlock()
+	idleTimeout, isIdle = 0, nil
+	atomic.StoreInt64(&lastActivity, 0)
+	healthChecks = nil
+	atomic.StoreInt32(&exitCode, 0)
+	atomic.StoreInt64(&runningSince, 0)
+	atomic.StoreInt32(&preShutdown, 0)
+	startCancelL.Lock()
+	inStart, startCancelled = false, false
+	startCtx, startCtxCancel = context.Background(), func() {}
+	startCancelL.Unlock()
+	resetShutdownInfo()
+	resetShutdownContext()
+	resetInFlight()
+	resetSubscribers()
+	atomic.StoreUint64(&droppedEvents, 0)
+}
+
+// launchSignalMonitor starts monitorSignal() in background, skipped in test
+// mode. Replaceable for test.
+var launchSignalMonitor = func(ready *sync.WaitGroup, end <-chan struct{}) {
+	if reset.TestMode() {
+		return
+	}
+	ready.Add(1)
+	go monitorSignal(ready, end)
+}
+
+func monitorSignal(ready *sync.WaitGroup, end <-chan struct{}) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	log.Printf("[%s] Receive %v signal, start shutdown", tag, <-c)
+	after := clock.After
+	ready.Done()
+	handleSignals(c, end, after)
+}
 
-	go func() {
-		log.Fatalf("[%s] Receive %v again, exit immediately", tag, <-c)
-	}()
+// handleSignals shutdown on the first signal received from c, after the
+// pre-shutdown delay if set, then exit with code 1 after shutdown complete,
+// or another signal received, or shutdown timeout. If the signal received
+// during Start(), cancels the start, Start() rollbacks started packages and
+// exit with code 1; if the rollback not done before end closed, another
+// signal or shutdown timeout forces exit, in case of a hanging onStart. after
+// is time.After(), injectable for test.
+func handleSignals(c <-chan os.Signal, end <-chan struct{}, after func(time.Duration) <-chan time.Time) {
+	sig := <-c
+	setShutdownCause(CauseSignal, sig)
+	if cancelStart() {
+		logf("Receive %v signal during start, cancel start", sig)
+		select {
+		case <-end:
+			return
+		case sig := <-c:
+			logf("Receive %v again, exit immediately", sig)
+		case <-after(shutdownTimeout):
+			warnf("Cancel start timeout")
+		}
+		exit(1)
+		return
+	}
+	if preShutdownDelay > 0 {
+		logf("Receive %v signal, shutdown after %v", sig, preShutdownDelay)
+		atomic.StoreInt32(&preShutdown, 1)
+		select {
+		case sig := <-c:
+			logf("Receive %v again, exit immediately", sig)
+			exit(1)
+			return
+		case <-after(preShutdownDelay):
+		}
+	}
+	logf("Receive %v signal, start shutdown", sig)
 
+	setSignalExitAt(time.Now().Add(shutdownTimeout))
 	done := make(chan struct{})
 	go func() {
 		Shutdown()
-		done <- struct{}{}
+		close(done)
 	}()
 
 	select {
 	case <-done:
-		break
-	case <-time.After(60 * time.Second):
-		log.Printf("[%s] Shutdown timeout", tag)
+	case sig := <-c:
+		logf("Receive %v again, exit immediately", sig)
+	case <-after(shutdownTimeout):
+		warnf("Shutdown timeout")
 	}
-	os.Exit(1)
+	exit(1)
 }
@@ -1,9 +1,15 @@
 package life_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"log"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/redforks/life"
@@ -39,6 +45,154 @@ var _ = Describe("life", func() {
 		}).Should(matcher.Panics("[life] package 'pkg1' already registered"))
 	})
 
+	It("Register self dependency", func() {
+		Ω(func() {
+			Register("pkg1", nil, nil, "pkg2", "pkg1")
+		}).Should(matcher.Panics("[life] package 'pkg1' depends on itself"))
+	})
+
+	It("Require registered dependencies", func() {
+		SetRequireRegisteredDependencies(true)
+		RegisterWithOpts("db", nil, nil, RegisterOpts{Aliases: []string{"database"}})
+		Register("api", nil, nil, "db", "database")
+		Ω(func() {
+			Register("web", nil, nil, "api", "cache")
+		}).Should(matcher.Panics("[life] package 'web' depends on 'cache' not registered yet"))
+		Register("cache", nil, nil)
+		Start()
+		Ω(func() {
+			SetRequireRegisteredDependencies(false)
+		}).Should(matcher.Panics(`[life] Can not set require registered dependencies in "Running" state`))
+	})
+
+	It("AddDepends", func() {
+		Register("api", newLogFunc("api"), nil, "db")
+		Register("db", newLogFunc("db"), nil)
+		Register("trace", newLogFunc("trace"), nil)
+		AddDepends("api", "trace")
+		AddDepends("db", "trace")
+		Ω(func() {
+			AddDepends("not-exist", "trace")
+		}).Should(matcher.Panics("[life] package 'not-exist' not registered"))
+		Ω(func() {
+			AddDepends("api", "api")
+		}).Should(matcher.Panics("[life] package 'api' depends on itself"))
+		Start()
+		assertLog("trace\ndb\napi\n")
+		Ω(func() {
+			AddDepends("api", "db")
+		}).Should(matcher.Panics(`[life] Can not add depends to package "api" in "Running" state`))
+	})
+
+	It("Reject nil callbacks", func() {
+		SetRejectNilCallbacks(true)
+		Ω(func() {
+			Register("pkg", nil, nil)
+		}).Should(matcher.Panics("[life] package 'pkg' has neither onStart nor onShutdown callback, use RegisterAnchor() for ordering only package"))
+		Ω(RegisterE("pkg", nil, nil)).Should(HaveOccurred())
+		Register("db", newLogFunc("db"), nil)
+		Register("cache", nil, newLogFunc("~cache"))
+		RegisterAnchor("storage", "db", "cache")
+		Register("api", newLogFunc("api"), nil, "storage")
+		Start()
+		Shutdown()
+		assertLog("db\napi\n~cache\n")
+		Ω(func() {
+			RegisterAnchor("late")
+		}).Should(matcher.Panics(`[life] Can not register package "late" in "halt" state`))
+	})
+
+	It("RegisterStart and RegisterShutdown", func() {
+		RegisterShutdown("lock", newLogFunc("~lock"))
+		RegisterStart("db", newLogFunc("db"), "lock")
+		RegisterShutdown("cache", newLogFunc("~cache"), "db")
+		Ω(StartOrder()).Should(Equal([]string{"lock", "db", "cache"}))
+		Start()
+		Shutdown()
+		assertLog("db\n~cache\n~lock\n")
+	})
+
+	Context("RegisterE", func() {
+
+		It("Succeed", func() {
+			Ω(RegisterE("pkg1", newLogFunc("pkg1"), nil)).Should(Succeed())
+			Start()
+			assertLog("pkg1\n")
+		})
+
+		It("Duplicate", func() {
+			Ω(RegisterE("pkg1", nil, nil)).Should(Succeed())
+			Ω(RegisterE("pkg1", nil, nil)).Should(MatchError("package 'pkg1' already registered"))
+		})
+
+		It("Self dependency", func() {
+			Ω(RegisterE("pkg1", nil, nil, "pkg1")).Should(MatchError("package 'pkg1' depends on itself"))
+		})
+
+		It("Wrong state", func() {
+			Start()
+			Ω(RegisterE("pkg1", nil, nil)).Should(MatchError("Can not register package \"pkg1\" in \"Running\" state"))
+		})
+
+	})
+
+	Context("RegisterSetup", func() {
+
+		It("Cleanup", func() {
+			RegisterSetup("pkg1", func() (func(), error) {
+				appendLog("setup pkg1")
+				return newLogFunc("cleanup pkg1"), nil
+			})
+			RegisterSetup("pkg2", func() (func(), error) {
+				appendLog("setup pkg2")
+				return nil, nil
+			}, "pkg1")
+			Start()
+			Shutdown()
+			assertLog("setup pkg1\nsetup pkg2\ncleanup pkg1\n")
+		})
+
+		It("Setup failed", func() {
+			RegisterSetup("pkg1", func() (func(), error) {
+				return newLogFunc("cleanup pkg1"), nil
+			})
+			RegisterSetup("pkg2", func() (func(), error) {
+				return newLogFunc("cleanup pkg2"), fmt.Errorf("pkg2 failed")
+			}, "pkg1")
+			Ω(Start).Should(Panic())
+			assertLog("cleanup pkg1\nExit 10\n")
+		})
+
+	})
+
+	It("Reset restores default config", func() {
+		closed := make(chan struct{})
+		close(closed)
+
+		SetObserver(logObserver{})
+		SetShutdownPolicy(BestEffort)
+		SetNameNormalizer(strings.ToLower)
+		SetDrainTime(time.Hour)
+		SetStartDeadline(time.Nanosecond)
+		ShutdownOn(closed)
+		reset.Disable()
+		reset.Enable()
+		slog = ""
+		// reset restores hal.Exit to os.Exit
+		hal.Exit = func(n int) {
+			appendLog("Exit " + strconv.Itoa(n))
+		}
+
+		Register("a", newLogFunc("a"), nil, "B")
+		Register("b", newLogFunc("b"), func() {
+			panic("b")
+		})
+		Start()
+		Consistently(State, 0.02).Should(Equal(Running))
+		Ω(Shutdown).Should(Panic())
+		assertLog("a\nb\nExit 11\n")
+	})
+
 	It("OnStart One", func() {
 		Register("pkg1", func() {
 			appendLog("pkg1")
@@ -117,6 +271,276 @@ var _ = Describe("life", func() {
 		assertLog("start1\nstop1\nExit 10\n")
 	})
 
+	Context("OnShutdownLate", func() {
+
+		It("Run after package own shutdown", func() {
+			Register("pkg1", nil, newLogFunc("pkg1"))
+			Register("pkg2", func() {
+				OnShutdownLate("pkg2", newLogFunc("late1"))
+			}, newLogFunc("pkg2"), "pkg1")
+			Register("pkg3", nil, newLogFunc("pkg3"), "pkg2")
+			Start()
+			OnShutdownLate("pkg2", newLogFunc("late2"))
+			Shutdown()
+			assertLog("pkg3\npkg2\nlate2\nlate1\npkg1\n")
+		})
+
+		It("Package without shutdown", func() {
+			Register("pkg1", nil, nil)
+			Start()
+			OnShutdownLate("pkg1", newLogFunc("late"))
+			Shutdown()
+			assertLog("late\n")
+		})
+
+		It("Not registered", func() {
+			Start()
+			Ω(func() {
+				OnShutdownLate("pkg1", nil)
+			}).Should(matcher.Panics("[life] package 'pkg1' not registered"))
+		})
+
+		It("Initing", func() {
+			Register("pkg1", nil, nil)
+			Ω(func() {
+				OnShutdownLate("pkg1", nil)
+			}).Should(matcher.Panics("[life] Can not add shutdown callback to package \"pkg1\" in \"Initing\" state"))
+		})
+
+		It("Shutingdown", func() {
+			Register("pkg1", nil, func() {
+				OnShutdownLate("pkg1", nil)
+			})
+			Start()
+			Ω(Shutdown).Should(matcher.Panics("[life] Can not add shutdown callback to package \"pkg1\" in \"Shutingdown\" state"))
+		})
+
+	})
+
+	Context("Shutdown gate", func() {
+
+		It("Wait until open", func() {
+			var polls int32
+			RegisterShutdownGate("gate", func() bool {
+				return atomic.AddInt32(&polls, 1) > 3
+			})
+			RegisterShutdownGate("open", func() bool {
+				return true
+			})
+			Register("pkg", nil, func() {
+				Ω(atomic.LoadInt32(&polls)).Should(BeEquivalentTo(4))
+				appendLog("pkg")
+			})
+			Start()
+			Shutdown()
+			assertLog("pkg\n")
+		})
+
+		It("Timeout", func() {
+			SetShutdownTimeout(30 * time.Millisecond)
+			RegisterShutdownGate("gate", func() bool {
+				return false
+			})
+			Register("pkg", nil, newLogFunc("pkg"))
+			Start()
+			start := time.Now()
+			Shutdown()
+			Ω(time.Since(start)).Should(BeNumerically(">=", 30*time.Millisecond))
+			assertLog("pkg\n")
+		})
+
+		It("Register in wrong state", func() {
+			Start()
+			Ω(func() {
+				RegisterShutdownGate("gate", nil)
+			}).Should(matcher.Panics("[life] Can not register shutdown gate \"gate\" in \"Running\" state"))
+		})
+
+	})
+
+	Context("Shutdown policy", func() {
+
+		BeforeEach(func() {
+			Register("pkg1", nil, newLogFunc("pkg1"))
+			Register("pkg2", nil, func() {
+				panic("pkg2")
+			})
+			Register("pkg3", nil, newLogFunc("pkg3"))
+			Register("pkg4", nil, func() {
+				panic("pkg4")
+			})
+		})
+
+		It("FailFast", func() {
+			Start()
+			Ω(Shutdown).Should(Panic())
+			assertLog("Exit 11\n")
+		})
+
+		It("BestEffort", func() {
+			SetShutdownPolicy(BestEffort)
+			Start()
+			Shutdown()
+			assertLog("pkg3\npkg1\n")
+			Ω(State()).Should(Equal(Halt))
+			Ω(ShutdownError()).Should(MatchError("shutdown package pkg4: pkg4\nshutdown package pkg2: pkg2"))
+		})
+
+		It("No error", func() {
+			SetShutdownPolicy(BestEffort)
+			Ω(ShutdownError()).Should(Succeed())
+		})
+
+		It("ShutdownAndWait", func() {
+			SetShutdownPolicy(BestEffort)
+			Start()
+			r := ShutdownAndWait()
+			Ω(r.Err).Should(MatchError("shutdown package pkg4: pkg4\nshutdown package pkg2: pkg2"))
+			Ω(r.Duration).Should(BeNumerically(">", 0))
+			assertLog("pkg3\npkg1\n")
+		})
+
+		It("Panic policy", func() {
+			var got []string
+			SetPanicPolicy(func(phase, pkg string, recovered interface{}) PanicAction {
+				got = append(got, fmt.Sprintf("%s %s %v", phase, pkg, recovered))
+				if pkg == "pkg4" {
+					return PanicContinue
+				}
+				return PanicAbort
+			})
+			Start()
+			Ω(Shutdown).Should(Panic())
+			Ω(got).Should(Equal([]string{"shutdown pkg4 pkg4", "shutdown pkg2 pkg2"}))
+			assertLog("pkg3\nExit 11\n")
+		})
+
+		It("Continue on start", func() {
+			Register("pkg5", func() {
+				panic("pkg5")
+			}, nil)
+			Register("pkg6", newLogFunc("start pkg6"), nil, "pkg5")
+			SetPanicPolicy(func(string, string, interface{}) PanicAction {
+				return PanicContinue
+			})
+			Start()
+			Ω(State()).Should(Equal(Running))
+			Shutdown()
+			assertLog("start pkg6\npkg3\npkg1\n")
+			Ω(ShutdownError()).Should(MatchError("shutdown package pkg4: pkg4\nshutdown package pkg2: pkg2"))
+		})
+
+		It("SetPanicPolicy in wrong state", func() {
+			SetShutdownPolicy(BestEffort)
+			Start()
+			Ω(func() {
+				SetPanicPolicy(nil)
+			}).Should(matcher.Panics(`[life] Can not set panic policy in "Running" state`))
+		})
+
+	})
+
+	Context("OnRunning", func() {
+
+		BeforeEach(func() {
+			RegisterHook("running", 0, BeforeRunning, func() {
+				appendLog("BeforeRunning")
+			})
+			OnRunning(func() {
+				appendLog("OnRunning " + State().String())
+			})
+		})
+
+		It("Run after Running", func() {
+			Register("pkg", newLogFunc("start pkg"), nil)
+			Start()
+			assertLog("start pkg\nBeforeRunning\nOnRunning Running\n")
+		})
+
+		It("Not run if start failed", func() {
+			Register("pkg", func() {
+				panic("pkg")
+			}, nil)
+			Ω(Start).Should(Panic())
+			assertLog("Exit 10\n")
+		})
+
+		It("Shutdown in OnRunning", func() {
+			OnRunning(Shutdown)
+			Start()
+			Ω(State()).Should(Equal(Halt))
+			assertLog("BeforeRunning\nOnRunning Running\n")
+		})
+
+		It("OnRunning in wrong state", func() {
+			Start()
+			Ω(func() {
+				OnRunning(func() {})
+			}).Should(matcher.Panics(`[life] Can not register OnRunning function in "Running" state`))
+		})
+
+	})
+
+	Context("Callback middleware", func() {
+
+		BeforeEach(func() {
+			SetCallbackMiddleware(func(name, phase string, next Callback) Callback {
+				return func() {
+					appendLog("before " + phase + " " + name)
+					next()
+					appendLog("after " + phase + " " + name)
+				}
+			})
+		})
+
+		It("Wraps start and shutdown callbacks", func() {
+			Register("pkg1", newLogFunc("start pkg1"), newLogFunc("shutdown pkg1"))
+			Register("pkg2", nil, newLogFunc("shutdown pkg2"), "pkg1")
+			Start()
+			assertLog("before start pkg1\nstart pkg1\nafter start pkg1\n")
+			Shutdown()
+			assertLog("before shutdown pkg2\nshutdown pkg2\nafter shutdown pkg2\n" +
+				"before shutdown pkg1\nshutdown pkg1\nafter shutdown pkg1\n")
+		})
+
+		It("SetCallbackMiddleware in wrong state", func() {
+			Start()
+			Ω(func() {
+				SetCallbackMiddleware(nil)
+			}).Should(matcher.Panics(`[life] Can not set callback middleware in "Running" state`))
+		})
+
+	})
+
+	Context("ShutdownAndWait", func() {
+
+		It("Succeed", func() {
+			Start()
+			Ω(ShutdownAndWait().Err).Should(Succeed())
+			Ω(State()).Should(Equal(Halt))
+		})
+
+		It("Before start", func() {
+			Ω(ShutdownAndWait()).Should(Equal(ShutdownOutcome{}))
+			Ω(State()).Should(Equal(Halt))
+		})
+
+		It("Shutdown by other goroutine", func() {
+			Register("slow", nil, func() {
+				time.Sleep(10 * time.Millisecond)
+				appendLog("slow")
+			})
+			Start()
+			go Shutdown()
+			for State() == Running {
+				time.Sleep(time.Millisecond)
+			}
+			ShutdownAndWait()
+			assertLog("slow\n")
+		})
+
+	})
+
 	Context("WaitToEnd", func() {
 		var (
 			wait  chan struct{}
@@ -140,6 +564,16 @@ var _ = Describe("life", func() {
 			Ω(time.Since(start)).Should(BeNumerically(">", delayMin))
 		}
 
+		It("WaitersCount", func() {
+			Start()
+			Ω(WaitersCount()).Should(Equal(0))
+			startWait()
+			Eventually(WaitersCount).Should(Equal(1))
+			Shutdown()
+			Eventually(wait).Should(BeClosed())
+			Ω(WaitersCount()).Should(Equal(0))
+		})
+
 		It("block until shutdown", func() {
 			Register("pkg", nil, func() {
 				time.Sleep(5 * time.Millisecond)
@@ -169,6 +603,35 @@ var _ = Describe("life", func() {
 			assertShutdown(0, 5*time.Millisecond)
 		})
 
+		It("Shutdown before start", func() {
+			Register("pkg", newLogFunc("start"), newLogFunc("stop"))
+			RegisterHook("hook", 0, BeforeShutingdown, newLogFunc("hook"))
+			startWait()
+			Shutdown()
+			assertShutdown(0, 5*time.Millisecond)
+			Ω(State()).Should(Equal(Halt))
+
+			// WaitToEnd returns immediately
+			WaitToEnd()
+			Ω(Start).Should(matcher.Panics("[life] Can not start in \"halt\" state"))
+			assertLog("Exit 10\n")
+		})
+
+		It("Called in onStart", func() {
+			Register("pkg", func() {
+				WaitToEnd()
+			}, nil)
+			Ω(Start).Should(matcher.Panics("[life] WaitToEnd called during startup"))
+		})
+
+		It("Called in onShutdown", func() {
+			Register("pkg", nil, func() {
+				WaitToEnd()
+			})
+			Start()
+			Ω(Shutdown).Should(matcher.Panics("[life] WaitToEnd called during shutdown"))
+		})
+
 		It("Shutdown wait for ongoing shutdown request", func() {
 			Register("pkg", nil, func() {
 				time.Sleep(5 * time.Millisecond)
@@ -218,6 +681,432 @@ var _ = Describe("life", func() {
 
 		})
 
+		It("SetErrorHandler", func() {
+			var handled interface{}
+			SetErrorHandler(func(_ context.Context, err interface{}) {
+				handled = err
+			})
+			Register("pkg", func() {
+				panic("error")
+			}, nil)
+
+			Ω(Start).Should(Panic())
+			Ω(handled).Should(Equal("error"))
+			assertLog("Exit 10\n")
+		})
+
+	})
+
+	Context("Start deadline", func() {
+
+		It("Dump stacks and abort", func() {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			exitCode := make(chan int, 1)
+			hal.Exit = func(n int) {
+				exitCode <- n
+			}
+			SetStartDeadline(10 * time.Millisecond)
+			RegisterHook("abort", 0, OnAbort, newLogFunc("abort"))
+			Register("hang", func() {
+				appendLog("Exit " + strconv.Itoa(<-exitCode))
+			}, nil)
+			Start()
+			assertLog("abort\nExit 10\n")
+			Ω(buf.String()).Should(ContainSubstring("[life] Start not complete in 10ms, goroutine stacks:\ngoroutine "))
+		})
+
+		It("Start in time", func() {
+			SetStartDeadline(time.Second)
+			Register("pkg", newLogFunc("pkg"), nil)
+			Start()
+			assertLog("pkg\n")
+		})
+
+	})
+
+	Context("StartContext", func() {
+
+		It("Start in time", func() {
+			Register("pkg", func() {
+				Ω(StartingContext().Err()).Should(Succeed())
+				appendLog("pkg")
+			}, nil)
+			Ω(StartingContext()).Should(Equal(context.Background()))
+			Ω(StartContext(context.Background())).Should(Succeed())
+			Ω(State()).Should(Equal(Running))
+			Ω(StartingContext().Err()).Should(Equal(context.Canceled))
+			assertLog("pkg\n")
+		})
+
+		It("Cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			Register("a", func() {
+				appendLog("a")
+			}, newLogFunc("~a"))
+			Register("b", func() {
+				appendLog("b")
+				cancel()
+				Ω(StartingContext().Err()).Should(Equal(context.Canceled))
+			}, newLogFunc("~b"), "a")
+			Register("c", newLogFunc("c"), newLogFunc("~c"), "b")
+			Ω(StartContext(ctx)).Should(Equal(context.Canceled))
+			Ω(State()).Should(Equal(Halt))
+			assertLog("a\nb\n~b\n~a\n")
+			WaitToEnd()
+		})
+
+	})
+
+	Context("ShutdownOn", func() {
+
+		It("Shutdown on channel close", func() {
+			ch := make(chan struct{})
+			Register("pkg", nil, newLogFunc("pkg"))
+			ShutdownOn(ch)
+			Start()
+			close(ch)
+			Eventually(State).Should(Equal(Halt))
+			assertLog("pkg\n")
+		})
+
+		It("Closed before start", func() {
+			ch := make(chan struct{})
+			close(ch)
+			ShutdownOn(ch)
+			Start()
+			Eventually(State).Should(Equal(Halt))
+		})
+
+		It("Shutdown by other reason", func() {
+			ch := make(chan struct{})
+			Register("pkg", nil, newLogFunc("pkg"))
+			ShutdownOn(ch)
+			Start()
+			Shutdown()
+			close(ch)
+			Consistently(State).Should(Equal(Halt))
+			assertLog("pkg\n")
+		})
+
+		It("Register in wrong state", func() {
+			Start()
+			Ω(func() {
+				ShutdownOn(make(chan struct{}))
+			}).Should(Panic())
+		})
+
+	})
+
+	It("Warn leaks on rollback", func() {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		var conn *strings.Reader
+		Register("conn", func() {
+			conn = strings.NewReader("allocated")
+		}, nil)
+		Register("no-start", nil, nil)
+		Register("db", newLogFunc("db"), newLogFunc("~db"))
+		Register("fail", func() {
+			panic("fail")
+		}, nil, "conn", "no-start", "db")
+		Ω(Start).Should(Panic())
+		Ω(conn).ShouldNot(BeNil())
+		Ω(buf.String()).Should(ContainSubstring("[life] Rollback packages started without onShutdown callback, resources may leak: conn\n"))
+		assertLog("db\n~db\nExit 10\n")
+	})
+
+	Context("StartedPackages", func() {
+
+		It("All started", func() {
+			Register("a", nil, nil)
+			Register("b", nil, nil)
+			started, total := StartedPackages()
+			Ω([]int{started, total}).Should(Equal([]int{0, 2}))
+			Start()
+			started, total = StartedPackages()
+			Ω([]int{started, total}).Should(Equal([]int{2, 2}))
+		})
+
+		It("Start failed", func() {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			Register("a", nil, nil)
+			Register("db", func() {
+				panic("db")
+			}, nil, "a")
+			Register("c", nil, nil, "db")
+			Ω(Start).Should(Panic())
+			started, total := StartedPackages()
+			Ω([]int{started, total}).Should(Equal([]int{1, 3}))
+			Ω(buf.String()).Should(ContainSubstring("[life] Started 1 of 3 packages before failing on 'db', shutdown all started packages\n"))
+		})
+
+	})
+
+	Context("ExitCode", func() {
+
+		It("Clean", func() {
+			Start()
+			Shutdown()
+			Ω(ExitCode()).Should(Equal(0))
+		})
+
+		It("Start failed", func() {
+			Register("pkg", func() {
+				panic("pkg")
+			}, nil)
+			Ω(Start).Should(Panic())
+			Ω(ExitCode()).Should(Equal(StartFailedExitCode))
+		})
+
+		It("Shutdown failed", func() {
+			Register("pkg", nil, func() {
+				panic("pkg")
+			})
+			Start()
+			Ω(Shutdown).Should(Panic())
+			Ω(ExitCode()).Should(Equal(ShutdownFailedExitCode))
+		})
+
+		It("Shutdown failed in BestEffort", func() {
+			SetShutdownPolicy(BestEffort)
+			Register("pkg", nil, func() {
+				panic("pkg")
+			})
+			Start()
+			Shutdown()
+			Ω(ExitCode()).Should(Equal(ShutdownFailedExitCode))
+			assertLog("")
+		})
+
+		It("Caller owns exit", func() {
+			SetExitHandling(false)
+			Register("pkg", func() {
+				panic("pkg")
+			}, nil)
+			Ω(Start).Should(Panic())
+			Ω(ExitCode()).Should(Equal(StartFailedExitCode))
+			Ω(State()).Should(Equal(Exited))
+			// the first exit wins
+			Abort()
+			Ω(ExitCode()).Should(Equal(StartFailedExitCode))
+			assertLog("")
+			Ω(func() {
+				SetExitHandling(true)
+			}).Should(matcher.Panics(`[life] Can not set exit handling in "Exited" state`))
+		})
+
+		It("Caller owns exit on shutdown failure", func() {
+			SetExitHandling(false)
+			Register("pkg", nil, func() {
+				panic("pkg")
+			})
+			Start()
+			Ω(Shutdown).Should(Panic())
+			Ω(ExitCode()).Should(Equal(ShutdownFailedExitCode))
+			Ω(State()).Should(Equal(Exited))
+			assertLog("")
+		})
+
+		It("Abort and Exit", func() {
+			Abort()
+			Ω(ExitCode()).Should(Equal(AbortExitCode))
+			Exit(3)
+			Ω(ExitCode()).Should(Equal(AbortExitCode))
+			assertLog("Exit 12\n")
+		})
+
+		It("Concurrent Exit", func() {
+			var aborts int32
+			RegisterHook("abort", 0, OnAbort, func() {
+				atomic.AddInt32(&aborts, 1)
+				time.Sleep(10 * time.Millisecond)
+			})
+			hal.Exit = func(n int) {}
+
+			var wg sync.WaitGroup
+			for i := 1; i <= 5; i++ {
+				wg.Add(1)
+				go func(n int) {
+					defer wg.Done()
+					Exit(n)
+				}(i)
+			}
+			wg.Wait()
+			Ω(atomic.LoadInt32(&aborts)).Should(Equal(int32(1)))
+			Ω(ExitCode()).Should(BeNumerically(">=", 1))
+			Ω(ExitCode()).Should(BeNumerically("<=", 5))
+		})
+
+		It("Abort during start failure", func() {
+			var aborts int32
+			RegisterHook("abort", 0, OnAbort, func() {
+				atomic.AddInt32(&aborts, 1)
+				time.Sleep(10 * time.Millisecond)
+			})
+			var exits int32
+			hal.Exit = func(int) {
+				atomic.AddInt32(&exits, 1)
+			}
+			Register("pkg", func() {
+				go Abort()
+				time.Sleep(time.Millisecond)
+				panic("pkg")
+			}, nil)
+			Ω(Start).Should(Panic())
+			Abort()
+			Ω(atomic.LoadInt32(&aborts)).Should(Equal(int32(1)))
+			Ω(atomic.LoadInt32(&exits)).Should(Equal(int32(1)))
+		})
+
+	})
+
+	It("Generation", func() {
+		g := Generation()
+		Start()
+		Ω(Generation()).Should(Equal(g))
+		reset.Disable()
+		reset.Enable()
+		Ω(Generation()).Should(Equal(g + 1))
+	})
+
+	It("StateEnteredAt", func() {
+		_, ok := StateEnteredAt(Initing)
+		Ω(ok).Should(BeTrue())
+		_, ok = StateEnteredAt(Running)
+		Ω(ok).Should(BeFalse())
+
+		Start()
+		starting, ok := StateEnteredAt(Starting)
+		Ω(ok).Should(BeTrue())
+		running, ok := StateEnteredAt(Running)
+		Ω(ok).Should(BeTrue())
+		Ω(running).ShouldNot(BeTemporally("<", starting))
+
+		Shutdown()
+		halt, ok := StateEnteredAt(Halt)
+		Ω(ok).Should(BeTrue())
+		Ω(halt).ShouldNot(BeTemporally("<", running))
+		_, ok = StateEnteredAt(Exited)
+		Ω(ok).Should(BeFalse())
+	})
+
+	It("Signal monitored by default", func() {
+		launches, restore := CountSignalMonitor()
+		defer restore()
+		Start()
+		Ω(*launches).Should(Equal(1))
+		Shutdown()
+	})
+
+	It("SetSignalHandling", func() {
+		launches, restore := CountSignalMonitor()
+		defer restore()
+		SetSignalHandling(false)
+		Start()
+		Ω(State()).Should(Equal(Running))
+		Ω(*launches).Should(Equal(0))
+		Ω(func() {
+			SetSignalHandling(true)
+		}).Should(matcher.Panics(`[life] Can not set signal handling in "Running" state`))
+		Shutdown()
+		Ω(State()).Should(Equal(Halt))
+	})
+
+	Context("Corrupt state", func() {
+
+		BeforeEach(func() {
+			RegisterAbortHook("abort", 0, func(cause error) {
+				appendLog(fmt.Sprintf("cause: %v", cause))
+			})
+		})
+
+		It("Shutdown", func() {
+			ForceState(Shutingdown)
+			Ω(Shutdown).Should(matcher.Panics("[life] corrupt internal state: Shutingdown"))
+			assertLog("cause: [life] corrupt internal state: Shutingdown\nExit 11\n")
+		})
+
+		It("WaitToEnd", func() {
+			ForceState(Draining)
+			Ω(WaitToEnd).Should(matcher.Panics("[life] corrupt internal state: Draining"))
+			assertLog("cause: corrupt internal state: Draining\nExit 12\n")
+			ForceState(Halt)
+		})
+
+	})
+
+	It("State transitions", func() {
+		legal := map[StateT][]StateT{
+			Initing:     {Starting, Halt},
+			Starting:    {Running, Halt},
+			Running:     {Draining, Shutingdown, Halt},
+			Draining:    {Shutingdown, Halt},
+			Shutingdown: {Halt},
+			Halt:        {Initing},
+		}
+		states := []StateT{Initing, Starting, Running, Draining, Shutingdown, Halt}
+		for _, from := range states {
+			for _, to := range states {
+				ForceState(from)
+				ok := from == to
+				for _, st := range legal[from] {
+					ok = ok || st == to
+				}
+				if ok {
+					Ω(func() { SetState(to) }).ShouldNot(Panic(), "%v -> %v", from, to)
+					Ω(State()).Should(Equal(to))
+				} else {
+					Ω(func() { SetState(to) }).Should(matcher.Panics(
+						fmt.Sprintf(`[life] Illegal state transition from "%v" to "%v"`, from, to)))
+					Ω(State()).Should(Equal(from))
+				}
+			}
+		}
+		ForceState(Halt)
+	})
+
+	Context("Min runtime", func() {
+
+		BeforeEach(func() {
+			SetMinRuntime(30 * time.Millisecond)
+		})
+
+		It("Throttle exit", func() {
+			Start()
+			start := time.Now()
+			Exit(1)
+			Ω(time.Since(start)).Should(BeNumerically(">=", 25*time.Millisecond))
+		})
+
+		It("Exit after min runtime", func() {
+			Start()
+			time.Sleep(30 * time.Millisecond)
+			start := time.Now()
+			Exit(1)
+			Ω(time.Since(start)).Should(BeNumerically("<", 20*time.Millisecond))
+		})
+
+		It("Clean exit", func() {
+			Start()
+			start := time.Now()
+			Exit(0)
+			Ω(time.Since(start)).Should(BeNumerically("<", 20*time.Millisecond))
+		})
+
+		It("Not running", func() {
+			start := time.Now()
+			Abort()
+			Ω(time.Since(start)).Should(BeNumerically("<", 20*time.Millisecond))
+		})
+
 	})
 
 	Context("Abort hooks", func() {
@@ -241,6 +1130,34 @@ var _ = Describe("life", func() {
 			assertLog("Exit 100\n")
 		})
 
+		It("Always run abort hooks", func() {
+			SetAlwaysRunAbortHooks(true)
+			RegisterHook("pkg1", 0, OnAbort, newLogFunc("foo"))
+			Shutdown()
+			Exit(100)
+			assertLog("foo\nExit 100\n")
+		})
+
+		It("Exited state", func() {
+			hal.Exit = func(n int) {
+				Ω(State()).Should(Equal(Exited))
+				appendLog("Exit " + strconv.Itoa(n))
+			}
+			Start()
+			Exit(1)
+			assertLog("Exit 1\n")
+			Ω(State()).Should(Equal(Exited))
+			Ω(Live()).Should(BeFalse())
+		})
+
+		It("Exited on start failure", func() {
+			Register("pkg", func() {
+				panic("pkg")
+			}, nil)
+			Ω(Start).Should(Panic())
+			Ω(State()).Should(Equal(Exited))
+		})
+
 		It("Call Abort on Abort", func() {
 			// Abort() calls Exit() internally, this test to ensure	even shutdown
 			// complete, call Abort() still triggers onAbort hooks
@@ -271,6 +1188,27 @@ var _ = Describe("life", func() {
 			assertLog("b\na\nc\n")
 		})
 
+		It("Shutdown in reversed start order", func() {
+			var started, stopped []string
+			reg := func(name string, depends ...string) {
+				Register(name, func() {
+					started = append(started, name)
+				}, func() {
+					stopped = append(stopped, name)
+				}, depends...)
+			}
+			reg("top", "left", "right")
+			reg("left", "base")
+			reg("right", "base")
+			reg("base")
+			reg("x")
+
+			Start()
+			Shutdown()
+			Ω(started).Should(Equal([]string{"base", "left", "right", "top", "x"}))
+			Ω(stopped).Should(Equal([]string{"x", "top", "right", "left", "base"}))
+		})
+
 		It("Loop dependency", func() {
 			Register("pkg1", nil, nil, "pkg2", "pkg3")
 			Register("pkg2", nil, nil, "pkg1")
@@ -278,11 +1216,270 @@ var _ = Describe("life", func() {
 			Ω(Start).Should(matcher.Panics("[life] Loop dependency detected\n\tpkg1 -> pkg2, pkg3\n\tpkg2 -> pkg1"))
 		})
 
+		It("Priority", func() {
+			Register("a", newLogFunc("a"), nil)
+			RegisterWithOpts("b", newLogFunc("b"), nil, RegisterOpts{Priority: -1})
+			RegisterWithOpts("c", newLogFunc("c"), nil, RegisterOpts{Priority: 1})
+			Register("d", newLogFunc("d"), nil)
+			Start()
+			assertLog("b\na\nd\nc\n")
+		})
+
+		It("Priority with dependency", func() {
+			RegisterWithOpts("a", newLogFunc("a"), nil, RegisterOpts{Depends: []string{"b"}, Priority: -1})
+			RegisterWithOpts("b", newLogFunc("b"), nil, RegisterOpts{Priority: 1})
+			Register("c", newLogFunc("c"), nil)
+			Start()
+			assertLog("c\nb\na\n")
+		})
+
+		Context("Phase", func() {
+
+			It("Lower phase first", func() {
+				RegisterWithOpts("api", newLogFunc("api"), newLogFunc("~api"), RegisterOpts{Phase: 2})
+				RegisterWithOpts("svc", newLogFunc("svc"), newLogFunc("~svc"), RegisterOpts{Phase: 1, Priority: -1})
+				RegisterWithOpts("db", newLogFunc("db"), newLogFunc("~db"), RegisterOpts{Priority: 1})
+				Register("cache", newLogFunc("cache"), newLogFunc("~cache"), "db")
+				Start()
+				Shutdown()
+				assertLog("db\ncache\nsvc\napi\n~api\n~svc\n~cache\n~db\n")
+			})
+
+			It("Depends on lower phase", func() {
+				RegisterWithOpts("svc", newLogFunc("svc"), nil, RegisterOpts{Phase: 1, Depends: []string{"db"}})
+				Register("db", newLogFunc("db"), nil)
+				Start()
+				assertLog("db\nsvc\n")
+			})
+
+			It("Depends on higher phase", func() {
+				Register("db", nil, nil, "svc")
+				RegisterWithOpts("svc", nil, nil, RegisterOpts{Phase: 1})
+				Ω(Start).Should(matcher.Panics(`[life] "db" of phase 0 depends on "svc" of higher phase 1`))
+			})
+
+		})
+
+		Context("ShutdownPriority", func() {
+
+			It("Reorders independent packages", func() {
+				RegisterWithOpts("log", newLogFunc("log"), newLogFunc("~log"), RegisterOpts{ShutdownPriority: 1})
+				Register("db", newLogFunc("db"), newLogFunc("~db"))
+				Register("api", newLogFunc("api"), newLogFunc("~api"), "db")
+				RegisterWithOpts("metrics", newLogFunc("metrics"), newLogFunc("~metrics"), RegisterOpts{ShutdownPriority: -1})
+				Ω(ShutdownOrder()).Should(Equal([]string{"metrics", "api", "db", "log"}))
+				Start()
+				Shutdown()
+				assertLog("log\ndb\napi\nmetrics\n~metrics\n~api\n~db\n~log\n")
+			})
+
+			It("Dependencies win", func() {
+				RegisterWithOpts("db", nil, newLogFunc("~db"), RegisterOpts{ShutdownPriority: -1})
+				Register("api", nil, newLogFunc("~api"), "db")
+				SetShutdownConcurrency(2)
+				Start()
+				Shutdown()
+				assertLog("~api\n~db\n")
+			})
+
+		})
+
+		Context("Aliases", func() {
+
+			It("Depends on alias", func() {
+				Register("api", newLogFunc("api"), newLogFunc("~api"), "database")
+				RegisterWithOpts("db", newLogFunc("db"), newLogFunc("~db"), RegisterOpts{Aliases: []string{"database"}})
+				SetShutdownConcurrency(2)
+				Start()
+				Shutdown()
+				assertLog("db\napi\n~api\n~db\n")
+			})
+
+			It("Collides with package", func() {
+				Register("db", nil, nil)
+				RegisterWithOpts("sql", nil, nil, RegisterOpts{Aliases: []string{"db"}})
+				Ω(Start).Should(matcher.Panics(`[life] alias 'db' of package 'sql' collides with package 'db'`))
+			})
+
+			It("Collides with alias", func() {
+				RegisterWithOpts("mysql", nil, nil, RegisterOpts{Aliases: []string{"db"}})
+				RegisterWithOpts("pg", nil, nil, RegisterOpts{Aliases: []string{"db"}})
+				Ω(Start).Should(matcher.Panics(`[life] alias 'db' of package 'pg' collides with package 'mysql'`))
+			})
+
+		})
+
+		Context("StartLast", func() {
+
+			It("Start after all", func() {
+				RegisterWithOpts("listener", newLogFunc("listener"), newLogFunc("~listener"), RegisterOpts{StartLast: true, Priority: -1})
+				RegisterWithOpts("api", newLogFunc("api"), newLogFunc("~api"), RegisterOpts{Phase: 2})
+				Register("db", newLogFunc("db"), newLogFunc("~db"))
+				Start()
+				Shutdown()
+				assertLog("db\napi\nlistener\n~listener\n~api\n~db\n")
+			})
+
+			It("Ordered among StartLast", func() {
+				RegisterWithOpts("a", newLogFunc("a"), nil, RegisterOpts{StartLast: true, Phase: 1, Depends: []string{"b"}})
+				RegisterWithOpts("b", newLogFunc("b"), nil, RegisterOpts{StartLast: true, Phase: 1, Priority: 1})
+				RegisterWithOpts("c", newLogFunc("c"), nil, RegisterOpts{StartLast: true})
+				RegisterWithOpts("d", newLogFunc("d"), nil, RegisterOpts{Phase: 3})
+				Start()
+				assertLog("d\nc\nb\na\n")
+			})
+
+			It("Depends on StartLast", func() {
+				RegisterWithOpts("listener", nil, nil, RegisterOpts{StartLast: true})
+				Register("db", nil, nil, "listener")
+				Ω(Start).Should(matcher.Panics(`[life] "db" depends on "listener" that starts last`))
+			})
+
+		})
+
+		Context("StartFirst", func() {
+
+			It("Start before all", func() {
+				RegisterWithOpts("listener", newLogFunc("listener"), newLogFunc("~listener"), RegisterOpts{StartLast: true})
+				Register("db", newLogFunc("db"), newLogFunc("~db"))
+				RegisterWithOpts("log", newLogFunc("log"), newLogFunc("~log"), RegisterOpts{StartFirst: true, Phase: 2, Priority: 1})
+				RegisterWithOpts("config", newLogFunc("config"), newLogFunc("~config"), RegisterOpts{StartFirst: true, Phase: 2})
+				Start()
+				Shutdown()
+				assertLog("config\nlog\ndb\nlistener\n~listener\n~db\n~log\n~config\n")
+			})
+
+			It("Depends among StartFirst", func() {
+				RegisterWithOpts("log", newLogFunc("log"), nil, RegisterOpts{StartFirst: true, Depends: []string{"config"}})
+				RegisterWithOpts("config", newLogFunc("config"), nil, RegisterOpts{StartFirst: true})
+				Register("db", newLogFunc("db"), nil, "log")
+				Start()
+				assertLog("config\nlog\ndb\n")
+			})
+
+			It("Depends on normal package", func() {
+				RegisterWithOpts("log", nil, nil, RegisterOpts{StartFirst: true, Depends: []string{"db"}})
+				Register("db", nil, nil)
+				Ω(Start).Should(matcher.Panics(`[life] "log" starts first, but depends on "db" that not`))
+			})
+
+			It("Both StartFirst and StartLast", func() {
+				Ω(func() {
+					RegisterWithOpts("a", nil, nil, RegisterOpts{StartFirst: true, StartLast: true})
+				}).Should(matcher.Panics("[life] package 'a' can not both StartFirst and StartLast"))
+			})
+
+		})
+
+		Context("Name normalizer", func() {
+
+			It("Default exact match", func() {
+				Register("a", newLogFunc("a"), nil, "DB")
+				Register("db", newLogFunc("db"), nil)
+				Start()
+				assertLog("a\ndb\n")
+			})
+
+			It("Case insensitive", func() {
+				SetNameNormalizer(strings.ToLower)
+				Register("a", newLogFunc("a"), nil, "DB")
+				Register("db", newLogFunc("db"), nil)
+				Start()
+				assertLog("db\na\n")
+			})
+
+			It("Name conflict", func() {
+				SetNameNormalizer(strings.ToLower)
+				Register("db", nil, nil)
+				Register("DB", nil, nil)
+				Ω(Start).Should(matcher.Panics("[life] package 'db' and 'DB' have the same normalized name 'db'"))
+			})
+
+		})
+
 		It("Depends on not exist package", func() {
 			Register("pkg2", nil, nil, "pkg1")
 			Ω(Start).ShouldNot(Panic(), "It is not error when depended package not registered, a warning will add to the log")
 		})
 
+		It("Depends on not exist package in strict mode", func() {
+			SetStrictDependencies(true)
+			Register("pkg2", nil, nil, "pkg1")
+			Ω(Start).Should(matcher.Panics("[life] \"pkg2\" depends on not exist package \"pkg1\""))
+		})
+
+	})
+
+	Context("Validate", func() {
+
+		It("Valid", func() {
+			Register("a", newLogFunc("a"), nil, "b")
+			Register("b", newLogFunc("b"), nil)
+			Ω(Validate()).Should(Succeed())
+			Ω(State()).Should(Equal(Initing))
+			assertLog("")
+		})
+
+		It("Reports all problems", func() {
+			SetStrictDependencies(true)
+			SetNameNormalizer(strings.ToLower)
+			Register("db", nil, nil)
+			Register("DB", nil, nil)
+			Register("a", nil, nil, "not-exist")
+			Register("b", nil, nil, "svc")
+			RegisterWithOpts("svc", nil, nil, RegisterOpts{Phase: 1})
+			Register("c", nil, nil, "d")
+			Register("d", nil, nil, "c")
+
+			err := Validate()
+			Ω(err).Should(HaveLen(4))
+			errs := err.(ErrorList)
+			Ω(errs[0]).Should(MatchError("package 'db' and 'DB' have the same normalized name 'db'"))
+			Ω(errs[1]).Should(MatchError(`"a" depends on not exist package "not-exist"`))
+			Ω(errs[2]).Should(MatchError(`"b" of phase 0 depends on "svc" of higher phase 1`))
+			Ω(errs[3]).Should(BeAssignableToTypeOf(&CycleError{}))
+			Ω(errs[3].(*CycleError).Cycle).Should(Equal([]string{"c", "d", "c"}))
+		})
+
+		It("Not Initing", func() {
+			Start()
+			Ω(func() { Validate() }).Should(matcher.Panics(`[life] Can not validate in "Running" state`))
+		})
+
+	})
+
+	Context("CheckCycles", func() {
+
+		It("No cycle", func() {
+			Register("a", nil, nil, "b", "not-exist")
+			Register("b", nil, nil)
+			Ω(CheckCycles()).Should(Succeed())
+			Start()
+			Ω(CheckCycles()).Should(Succeed())
+		})
+
+		It("Cycle", func() {
+			Register("a", nil, nil, "b")
+			RegisterWithOpts("b", nil, nil, RegisterOpts{Depends: []string{"c"}, Phase: 1})
+			RegisterWithOpts("c", nil, nil, RegisterOpts{Depends: []string{"old-a"}, Aliases: []string{"old-c"}})
+			RegisterWithOpts("d", nil, nil, RegisterOpts{Depends: []string{"a"}, Aliases: []string{"old-a"}})
+			RegisterWithOpts("e", nil, nil, RegisterOpts{Depends: []string{"old-c"}})
+			err := CheckCycles()
+			Ω(err).Should(BeAssignableToTypeOf(&CycleError{}))
+			Ω(err.(*CycleError).Cycle).Should(Equal([]string{"a", "b", "c", "d", "a"}))
+			Ω(State()).Should(Equal(Initing))
+		})
+
+	})
+
+	It("ParseState", func() {
+		for _, st := range []StateT{Initing, Starting, Running, Draining, Shutingdown, Halt, Exited} {
+			Ω(ParseState(st.String())).Should(Equal(st))
+		}
+		Ω(ParseState("running")).Should(Equal(Running))
+		Ω(ParseState("Halt")).Should(Equal(Halt))
+		_, err := ParseState("Paused")
+		Ω(err).Should(MatchError(`unknown state "Paused"`))
 	})
 
 	Context("EnsureState", func() {
@@ -303,6 +1500,23 @@ var _ = Describe("life", func() {
 				EnsureStatef(Starting, "msg %s %d", "foo", 1)
 			}).Should(matcher.Panics("msg foo 1"))
 		})
+
+		It("SetStateChecks", func() {
+			SetStateChecks(false)
+			Ω(func() {
+				EnsureState(Starting, "msg")
+				EnsureStatef(Starting, "msg %s", "foo")
+			}).ShouldNot(Panic())
+			Start()
+			Ω(func() {
+				SetDrainTime(0)
+			}).Should(matcher.Panics(`[life] Can not set drain time in "Running" state`))
+
+			SetStateChecks(true)
+			Ω(func() {
+				EnsureState(Initing, "msg")
+			}).Should(matcher.Panics("msg"))
+		})
 	})
 
 })
@@ -0,0 +1,20 @@
+package lifetest
+
+import "github.com/redforks/life"
+
+// TestingT is the subset of testing.T used by assertions, satisfied by
+// *testing.T and GinkgoT().
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// AssertCleanShutdown reports an error to t for each package started but not
+// shutdown, call it after shutdown to catch teardown skipped by some code
+// path. Packages with nil onShutdown callback count as shutdown.
+func AssertCleanShutdown(t TestingT) {
+	for _, p := range life.Packages() {
+		if p.Started && !p.Stopped {
+			t.Errorf("package '%s' started but not shutdown", p.Name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package lifetest
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// RandomDAG returns n fakes with random acyclic dependencies, in random
+// order, for property tests of dependency sorting, register them by
+// NewHarness(). Fakes named "p0" to "p<n-1>", a fake only depends on fakes of
+// lower number.
+func RandomDAG(r *rand.Rand, n int) []Fake {
+	fakes := make([]Fake, n)
+	for i := range fakes {
+		fakes[i].Name = fmt.Sprintf("p%d", i)
+		for j := 0; j < i; j++ {
+			if r.Intn(4) == 0 {
+				fakes[i].Depends = append(fakes[i].Depends, fmt.Sprintf("p%d", j))
+			}
+		}
+	}
+	r.Shuffle(n, func(i, j int) {
+		fakes[i], fakes[j] = fakes[j], fakes[i]
+	})
+	return fakes
+}
+
+// InjectCycle adds dependencies to random fakes to form a loop, each one
+// depends on the next, the last depends on the first. Returns names of fakes
+// in the loop. fakes must contain at least 2 elements.
+func InjectCycle(r *rand.Rand, fakes []Fake) []string {
+	loop := r.Perm(len(fakes))[:2+r.Intn(len(fakes)-1)]
+	names := make([]string, len(loop))
+	for i, idx := range loop {
+		next := fakes[loop[(i+1)%len(loop)]].Name
+		fakes[idx].Depends = append(fakes[idx].Depends, next)
+		names[i] = fakes[idx].Name
+	}
+	return names
+}
@@ -0,0 +1,100 @@
+package lifetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/redforks/life"
+)
+
+// Fake describes a fake package registered by Harness.
+type Fake struct {
+	Name    string
+	Depends []string
+
+	// StartDelay and ShutdownDelay are slept in onStart and onShutdown
+	// callbacks, to simulate slow packages.
+	StartDelay, ShutdownDelay time.Duration
+
+	// If not nil, onStart or onShutdown callback panics with the value after
+	// delay.
+	StartPanic, ShutdownPanic interface{}
+}
+
+// Harness registers fake packages, drives life through its life cycle, and
+// records call order and timings of callbacks. Harness works on the global
+// life state, enable reset (github.com/redforks/testing/reset) before
+// NewHarness() and disable it after the test:
+//
+//	h := lifetest.NewHarness(lifetest.Fake{Name: "db"}, lifetest.Fake{Name: "web", Depends: []string{"db"}})
+//	h.Start()
+//	h.Shutdown()
+//	// h.Order() == []string{"db", "web", "~web", "~db"}
+type Harness struct {
+	*Recorder
+
+	l       sync.Mutex
+	timings map[string]time.Duration
+}
+
+// NewHarness creates a Harness and registers fake packages, must be called in
+// Initing state.
+func NewHarness(fakes ...Fake) *Harness {
+	h := &Harness{Recorder: RecordOrder(), timings: make(map[string]time.Duration)}
+	for _, f := range fakes {
+		life.Register(f.Name,
+			h.callback(f.Name, f.StartDelay, f.StartPanic),
+			h.callback("~"+f.Name, f.ShutdownDelay, f.ShutdownPanic),
+			f.Depends...)
+	}
+	return h
+}
+
+func (h *Harness) callback(msg string, delay time.Duration, panicValue interface{}) life.Callback {
+	record := h.Func(msg)
+	return func() {
+		start := time.Now()
+		defer func() {
+			h.l.Lock()
+			h.timings[msg] = time.Since(start)
+			h.l.Unlock()
+		}()
+
+		time.Sleep(delay)
+		record()
+		if panicValue != nil {
+			panic(panicValue)
+		}
+	}
+}
+
+// Start calls life.Start().
+func (h *Harness) Start() {
+	life.Start()
+}
+
+// Shutdown calls life.Shutdown().
+func (h *Harness) Shutdown() {
+	life.Shutdown()
+}
+
+// Abort calls life.Abort().
+func (h *Harness) Abort() {
+	life.Abort()
+}
+
+// StartTime returns the time spent in onStart callback of package name,
+// zero if not called.
+func (h *Harness) StartTime(name string) time.Duration {
+	h.l.Lock()
+	defer h.l.Unlock()
+	return h.timings[name]
+}
+
+// ShutdownTime returns the time spent in onShutdown callback of package name,
+// zero if not called.
+func (h *Harness) ShutdownTime(name string) time.Duration {
+	h.l.Lock()
+	defer h.l.Unlock()
+	return h.timings["~"+name]
+}
@@ -0,0 +1,59 @@
+// Package lifetest contains helpers to test packages using life.
+package lifetest
+
+import (
+	"sync"
+
+	"github.com/redforks/life"
+)
+
+// Recorder records calls of callbacks created by StartFunc() and
+// ShutdownFunc(), to assert start and shutdown order:
+//
+//	r := lifetest.RecordOrder()
+//	life.Register("foo", r.StartFunc("foo"), r.ShutdownFunc("foo"))
+//	life.Start()
+//	life.Shutdown()
+//	// r.Order() == []string{"foo", "~foo"}
+type Recorder struct {
+	l     sync.Mutex
+	order []string
+}
+
+// RecordOrder creates a new Recorder.
+func RecordOrder() *Recorder {
+	return &Recorder{}
+}
+
+// StartFunc returns an onStart callback records name when called.
+func (r *Recorder) StartFunc(name string) life.Callback {
+	return r.Func(name)
+}
+
+// ShutdownFunc returns an onShutdown callback records "~" + name when called.
+func (r *Recorder) ShutdownFunc(name string) life.Callback {
+	return r.Func("~" + name)
+}
+
+// Func returns a callback records msg when called, can be used as hook.
+func (r *Recorder) Func(msg string) life.Callback {
+	return func() {
+		r.l.Lock()
+		defer r.l.Unlock()
+		r.order = append(r.order, msg)
+	}
+}
+
+// Order returns recorded messages in call order.
+func (r *Recorder) Order() []string {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return append([]string(nil), r.order...)
+}
+
+// Reset clears recorded messages.
+func (r *Recorder) Reset() {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.order = nil
+}
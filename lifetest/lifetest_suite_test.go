@@ -0,0 +1,13 @@
+package lifetest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLifetest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Lifetest Suite")
+}
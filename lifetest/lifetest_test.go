@@ -0,0 +1,159 @@
+package lifetest_test
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redforks/hal"
+	"github.com/redforks/life"
+	. "github.com/redforks/life/lifetest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Recorder", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Record order", func() {
+		r := RecordOrder()
+		life.Register("a", r.StartFunc("a"), r.ShutdownFunc("a"), "b")
+		life.Register("b", r.StartFunc("b"), r.ShutdownFunc("b"))
+		life.RegisterHook("hook", 0, life.BeforeRunning, life.HookFunc(r.Func("running")))
+		life.Start()
+		life.Shutdown()
+		Ω(r.Order()).Should(Equal([]string{"b", "a", "running", "~a", "~b"}))
+
+		r.Reset()
+		Ω(r.Order()).Should(BeEmpty())
+	})
+
+})
+
+var _ = Describe("Harness", func() {
+	var exitCode int
+
+	BeforeEach(func() {
+		reset.Enable()
+		exitCode = -1
+		hal.Exit = func(n int) {
+			exitCode = n
+		}
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Order and timings", func() {
+		h := NewHarness(
+			Fake{Name: "web", Depends: []string{"db"}, ShutdownDelay: 5 * time.Millisecond},
+			Fake{Name: "db", StartDelay: 5 * time.Millisecond},
+		)
+		h.Start()
+		h.Shutdown()
+		Ω(h.Order()).Should(Equal([]string{"db", "web", "~web", "~db"}))
+		Ω(h.StartTime("db")).Should(BeNumerically(">=", 5*time.Millisecond))
+		Ω(h.ShutdownTime("web")).Should(BeNumerically(">=", 5*time.Millisecond))
+		Ω(h.StartTime("none")).Should(BeZero())
+	})
+
+	It("Shutdown failure", func() {
+		life.SetShutdownPolicy(life.BestEffort)
+		h := NewHarness(Fake{Name: "a"}, Fake{Name: "b", ShutdownPanic: "b"})
+		h.Start()
+		h.Shutdown()
+		Ω(h.Order()).Should(Equal([]string{"a", "b", "~b", "~a"}))
+		Ω(life.ShutdownError()).Should(MatchError("shutdown package b: b"))
+	})
+
+	It("Abort", func() {
+		h := NewHarness(Fake{Name: "a"})
+		h.Start()
+		h.Abort()
+		Ω(exitCode).Should(Equal(life.AbortExitCode))
+	})
+
+})
+
+var _ = Describe("AssertCleanShutdown", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		hal.Exit = func(int) {}
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Clean", func() {
+		t := &fakeT{}
+		h := NewHarness(Fake{Name: "a"}, Fake{Name: "b", Depends: []string{"a"}})
+		life.RegisterStart("c", func() {})
+		h.Start()
+		h.Shutdown()
+		AssertCleanShutdown(t)
+		Ω(t.errors).Should(BeEmpty())
+	})
+
+	It("Shutdown skipped", func() {
+		t := &fakeT{}
+		h := NewHarness(Fake{Name: "a"}, Fake{Name: "b", Depends: []string{"a"}, ShutdownPanic: "b"})
+		h.Start()
+		Ω(h.Shutdown).Should(Panic())
+		AssertCleanShutdown(t)
+		Ω(t.errors).Should(Equal([]string{
+			"package 'a' started but not shutdown",
+			"package 'b' started but not shutdown",
+		}))
+	})
+
+})
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+var _ = Describe("Graph", func() {
+
+	It("RandomDAG", func() {
+		r := rand.New(rand.NewSource(1))
+		fakes := RandomDAG(r, 10)
+		Ω(fakes).Should(HaveLen(10))
+		// single digit names, compare as string
+		for _, f := range fakes {
+			for _, dep := range f.Depends {
+				Ω(dep < f.Name).Should(BeTrue(), "%s depends on %s", f.Name, dep)
+			}
+		}
+	})
+
+	It("InjectCycle", func() {
+		r := rand.New(rand.NewSource(1))
+		fakes := RandomDAG(r, 5)
+		loop := InjectCycle(r, fakes)
+		Ω(len(loop)).Should(BeNumerically(">=", 2))
+		depends := map[string][]string{}
+		for _, f := range fakes {
+			depends[f.Name] = f.Depends
+		}
+		for i, name := range loop {
+			Ω(depends[name]).Should(ContainElement(loop[(i+1)%len(loop)]))
+		}
+	})
+
+})
@@ -0,0 +1,118 @@
+package life
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// LogFormat is the format of log messages written by life package.
+type LogFormat int
+
+const (
+	// Human readable format, the default, such as:
+	//
+	//  [life] Starting package db
+	Human LogFormat = iota
+
+	// Structured format writes key=value pairs, for log aggregation systems,
+	// phase is the current life state, such as:
+	//
+	//  component=life phase=starting pkg=db msg="Starting package db"
+	Structured
+)
+
+var logFormat LogFormat
+
+// SetLogFormat set format of log messages, default is Human. Can only be
+// called in Initing state.
+func SetLogFormat(f LogFormat) {
+	ensureStatef(Initing, "[%s] Can not set log format in \"%v\" state", tag, State())
+	logFormat = f
+}
+
+// LogLevel is the minimal level of log messages written by life package.
+type LogLevel int
+
+const (
+	// LogDebug logs everything, including per package start and shutdown
+	// lines, and hook execution, the default.
+	LogDebug LogLevel = iota
+
+	// LogInfo logs state transitions and warnings.
+	LogInfo
+
+	// LogWarn only logs warnings and errors.
+	LogWarn
+)
+
+var logLevel LogLevel
+
+// SetLogLevel set the minimal level of log messages, default is LogDebug.
+// Services with many packages may set LogInfo in production to reduce log
+// volume. Can only be called in Initing state.
+func SetLogLevel(l LogLevel) {
+	ensureStatef(Initing, "[%s] Can not set log level in \"%v\" state", tag, State())
+	logLevel = l
+}
+
+// logf logs an info message not related to a specific package.
+func logf(format string, a ...interface{}) {
+	logAt(LogInfo, "", format, a...)
+}
+
+// logPkgf logs an info message related to package pkg.
+func logPkgf(pkg, format string, a ...interface{}) {
+	logAt(LogInfo, pkg, format, a...)
+}
+
+// debugf logs a debug message not related to a specific package.
+func debugf(format string, a ...interface{}) {
+	logAt(LogDebug, "", format, a...)
+}
+
+// debugPkgf logs a debug message related to package pkg.
+func debugPkgf(pkg, format string, a ...interface{}) {
+	logAt(LogDebug, pkg, format, a...)
+}
+
+// warnf logs a warning not related to a specific package.
+func warnf(format string, a ...interface{}) {
+	logAt(LogWarn, "", format, a...)
+}
+
+// warnPkgf logs a warning related to package pkg.
+func warnPkgf(pkg, format string, a ...interface{}) {
+	logAt(LogWarn, pkg, format, a...)
+}
+
+func logAt(level LogLevel, pkg, format string, a ...interface{}) {
+	if level < logLevel {
+		return
+	}
+
+	msg := fmt.Sprintf(format, a...)
+	if logFormat != Structured {
+		log.Printf("[%s] %s", tag, msg)
+		return
+	}
+
+	fields := []string{
+		"component=" + logValue(tag),
+		"phase=" + logValue(strings.ToLower(State().String())),
+	}
+	if pkg != "" {
+		fields = append(fields, "pkg="+logValue(pkg))
+	}
+	fields = append(fields, "msg="+strconv.Quote(msg))
+	log.Print(strings.Join(fields, " "))
+}
+
+// logValue quotes v if it is empty or contains special characters.
+func logValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
@@ -0,0 +1,111 @@
+package life_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Log format", func() {
+	var buf bytes.Buffer
+
+	BeforeEach(func() {
+		reset.Enable()
+		buf.Reset()
+		log.SetOutput(&buf)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+		reset.Disable()
+	})
+
+	It("Human", func() {
+		Register("db", nil, nil)
+		Start()
+		Ω(buf.String()).Should(ContainSubstring("[life] Starting package db\n"))
+		Ω(buf.String()).Should(ContainSubstring("[life] all packages started, ready to serve\n"))
+	})
+
+	It("Structured", func() {
+		SetLogFormat(Structured)
+		Register("db", nil, nil)
+		Register("my db", nil, nil)
+		Start()
+		Ω(buf.String()).Should(ContainSubstring(`component=life phase=starting pkg=db msg="Starting package db"` + "\n"))
+		Ω(buf.String()).Should(ContainSubstring(`component=life phase=starting pkg="my db" msg="Starting package my db"` + "\n"))
+		Ω(buf.String()).Should(ContainSubstring(`component=life phase=starting msg="all packages started, ready to serve"` + "\n"))
+	})
+
+	It("SetTag", func() {
+		SetTag("life:billing")
+		Register("db", nil, nil)
+		Start()
+		Ω(buf.String()).Should(ContainSubstring("[life:billing] Starting package db\n"))
+		Ω(func() {
+			SetTag("foo")
+		}).Should(matcher.Panics(`[life:billing] Can not set tag in "Running" state`))
+	})
+
+	It("Log level", func() {
+		SetLogLevel(LogInfo)
+		Register("db", nil, nil)
+		Start()
+		Shutdown()
+		Ω(buf.String()).ShouldNot(ContainSubstring("Starting package db"))
+		Ω(buf.String()).ShouldNot(ContainSubstring("Shutdown package db"))
+		Ω(buf.String()).Should(ContainSubstring("[life] all packages started, ready to serve\n"))
+		Ω(func() {
+			SetLogLevel(LogWarn)
+		}).Should(matcher.Panics(`[life] Can not set log level in "halt" state`))
+	})
+
+	It("Quiet package", func() {
+		RegisterWithOpts("db", nil, nil, RegisterOpts{Quiet: true})
+		Register("cache", nil, nil)
+		Start()
+		Shutdown()
+		Ω(buf.String()).ShouldNot(ContainSubstring("package db"))
+		Ω(buf.String()).Should(ContainSubstring("[life] Starting package cache\n"))
+		Ω(buf.String()).Should(ContainSubstring("[life] Shutdown package cache\n"))
+	})
+
+	It("Shutdown summary", func() {
+		SetDrainTime(time.Millisecond)
+		Register("db", nil, nil)
+		Register("cache", nil, nil)
+		Start()
+		Shutdown()
+		Ω(buf.String()).Should(MatchRegexp(`\[life\] Shutdown complete: uptime \S+, 2 packages shutdown, drain [1-9]\S*ms\n`))
+	})
+
+	It("Warn level", func() {
+		SetLogLevel(LogWarn)
+		SetShutdownPolicy(BestEffort)
+		Register("db", nil, func() {
+			panic("db")
+		})
+		Start()
+		Shutdown()
+		Ω(buf.String()).ShouldNot(ContainSubstring("ready to serve"))
+		Ω(buf.String()).Should(ContainSubstring("[life] Shutdown package db failed: db\n"))
+		Ω(buf.String()).Should(ContainSubstring("[life] 1 packages failed to shutdown\n"))
+	})
+
+	It("SetTag structured", func() {
+		SetTag("life:billing")
+		SetLogFormat(Structured)
+		Register("db", nil, nil)
+		Start()
+		Ω(buf.String()).Should(ContainSubstring(`component=life:billing phase=starting pkg=db msg="Starting package db"` + "\n"))
+	})
+
+})
@@ -0,0 +1,22 @@
+package life
+
+// see SetCallbackMiddleware(), nil means no middleware
+var callbackMiddleware func(name, phase string, next Callback) Callback
+
+// SetCallbackMiddleware set the function wraps every onStart and onShutdown
+// callback of packages, for cross-cutting concerns such as timing and tracing.
+// name is the package name, phase is PanicInStart or PanicInShutdown, next
+// is the original callback, which must be called by the returned callback.
+// Nil callbacks are not wrapped. Can only be called in Initing state.
+func SetCallbackMiddleware(middleware func(name, phase string, next Callback) Callback) {
+	ensureStatef(Initing, "[%s] Can not set callback middleware in \"%v\" state", tag, State())
+	callbackMiddleware = middleware
+}
+
+// wrapCallback wraps fn by callback middleware if set.
+func wrapCallback(phase, name string, fn Callback) Callback {
+	if callbackMiddleware == nil {
+		return fn
+	}
+	return callbackMiddleware(name, phase, fn)
+}
@@ -0,0 +1,90 @@
+package life
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// Starter is implemented by objects need to start, see RegisterObject().
+type Starter interface {
+	Start()
+}
+
+// Shutdowner is implemented by objects need to shutdown, see
+// RegisterObject().
+type Shutdowner interface {
+	Shutdown()
+}
+
+// RegisterObject register obj as a package. If obj implements Starter, its
+// Start() method is the onStart callback; if implements Shutdowner, its
+// Shutdown() method is the onShutdown callback. Depended packages are depends
+// plus those declared by struct tags of obj, see TagDepends().
+func RegisterObject(name string, obj interface{}, depends ...string) {
+	tagDepends, err := TagDepends(obj)
+	if err != nil {
+		log.Panicf("[%s] %s", tag, err)
+	}
+
+	var onStart, onShutdown Callback
+	if s, ok := obj.(Starter); ok {
+		onStart = s.Start
+	}
+	if s, ok := obj.(Shutdowner); ok {
+		onShutdown = s.Shutdown
+	}
+
+	opts := RegisterOpts{Depends: append(append([]string(nil), depends...), tagDepends...)}
+	RegisterWithOpts(name, onStart, onShutdown, opts)
+}
+
+// TagDepends returns depended packages declared by `life' tags of struct
+// fields, obj is a struct or pointer to struct. Returns nil for other types.
+//
+//  type Server struct {
+//    DB    *sql.DB `life:"depends=db"`
+//    Cache *Cache  `life:"depends=cache,redis"`
+//  }
+func TagDepends(obj interface{}) ([]string, error) {
+	t := reflect.TypeOf(obj)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var result []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		v, ok := f.Tag.Lookup("life")
+		if !ok {
+			continue
+		}
+
+		names, err := parseDependsTag(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %s", t.Name(), f.Name, err)
+		}
+		result = append(result, names...)
+	}
+	return result, nil
+}
+
+func parseDependsTag(v string) ([]string, error) {
+	const prefix = "depends="
+	if !strings.HasPrefix(v, prefix) {
+		return nil, fmt.Errorf("malformed life tag \"%s\", expect \"depends=name1,name2\"", v)
+	}
+
+	names := strings.Split(v[len(prefix):], ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if names[i] == "" {
+			return nil, fmt.Errorf("malformed life tag \"%s\", empty package name", v)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,86 @@
+package life_test
+
+import (
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+type server struct {
+	name  string
+	db    interface{} `life:"depends=db"`
+	cache interface{} `life:"depends=cache, redis"`
+	other int
+}
+
+func (s *server) Start() {
+	appendLog("start " + s.name)
+}
+
+func (s *server) Shutdown() {
+	appendLog("shutdown " + s.name)
+}
+
+type startOnly struct{}
+
+func (startOnly) Start() {
+	appendLog("start only")
+}
+
+type badTag struct {
+	db interface{} `life:"db"`
+}
+
+var _ = Describe("RegisterObject", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Starter and Shutdowner", func() {
+		RegisterObject("server", &server{name: "server"}, "log")
+		Register("log", newLogFunc("log"), nil)
+		Register("db", newLogFunc("db"), nil)
+		Register("cache", newLogFunc("cache"), nil)
+		Register("redis", newLogFunc("redis"), nil)
+		RegisterObject("start", startOnly{})
+
+		Ω(StartOrder()).Should(Equal([]string{"log", "db", "cache", "redis", "server", "start"}))
+		Start()
+		Shutdown()
+		assertLog("log\ndb\ncache\nredis\nstart server\nstart only\nshutdown server\n")
+	})
+
+	Context("TagDepends", func() {
+
+		It("Struct and pointer", func() {
+			Ω(TagDepends(server{})).Should(Equal([]string{"db", "cache", "redis"}))
+			Ω(TagDepends(&server{})).Should(Equal([]string{"db", "cache", "redis"}))
+		})
+
+		It("Not struct", func() {
+			Ω(TagDepends(nil)).Should(BeEmpty())
+			Ω(TagDepends(1)).Should(BeEmpty())
+			Ω(TagDepends(startOnly{})).Should(BeEmpty())
+		})
+
+		It("Malformed", func() {
+			_, err := TagDepends(badTag{})
+			Ω(err).Should(MatchError(`field badTag.db: malformed life tag "db", expect "depends=name1,name2"`))
+
+			Ω(func() {
+				RegisterObject("bad", badTag{})
+			}).Should(matcher.Panics(`[life] field badTag.db: malformed life tag "db", expect "depends=name1,name2"`))
+		})
+
+	})
+
+})
@@ -0,0 +1,40 @@
+package life
+
+import "time"
+
+// Observer receives life events, such as package start/stop timings and
+// state changes. Implement it to integrate with telemetry systems.
+//
+// Observer methods are called synchronously by life package, they should
+// return quickly, and must not call functions that change life state, such as
+// Shutdown().
+type Observer interface {
+	// PackageStarted called after onStart callback of package returned, d is
+	// the time spent by the callback.
+	PackageStarted(name string, d time.Duration)
+
+	// PackageStopped called after onShutdown callback of package returned, d
+	// is the time spent by the callback.
+	PackageStopped(name string, d time.Duration)
+
+	// StateChanged called after life state changed.
+	StateChanged(from, to StateT)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) PackageStarted(string, time.Duration) {}
+func (nopObserver) PackageStopped(string, time.Duration) {}
+func (nopObserver) StateChanged(_, _ StateT)             {}
+
+var observer Observer = nopObserver{}
+
+// SetObserver set the Observer receives life events, nil to remove current
+// observer. Can only be called in Initing state.
+func SetObserver(o Observer) {
+	ensureStatef(Initing, "[%s] Can not set observer in \"%v\" state", tag, State())
+	if o == nil {
+		o = nopObserver{}
+	}
+	observer = o
+}
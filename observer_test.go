@@ -0,0 +1,80 @@
+package life_test
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/hal"
+	"github.com/redforks/testing/reset"
+)
+
+type logObserver struct{}
+
+func (logObserver) PackageStarted(name string, d time.Duration) {
+	appendLog("started " + name)
+}
+
+func (logObserver) PackageStopped(name string, d time.Duration) {
+	appendLog("stopped " + name)
+}
+
+func (logObserver) StateChanged(from, to StateT) {
+	appendLog(fmt.Sprintf("%v -> %v", from, to))
+}
+
+var _ = Describe("Observer", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+
+		hal.Exit = func(n int) {
+			appendLog("Exit " + strconv.Itoa(n))
+		}
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Start and shutdown", func() {
+		SetObserver(logObserver{})
+		Register("a", nil, newLogFunc("stop a"))
+		Register("b", newLogFunc("start b"), nil, "a")
+		Start()
+		Shutdown()
+		assertLog(`Initing -> Starting
+started a
+start b
+started b
+Starting -> Running
+Running -> Shutingdown
+stopped b
+stop a
+stopped a
+Shutingdown -> halt
+`)
+	})
+
+	It("Failed package not reported", func() {
+		SetObserver(logObserver{})
+		Register("a", func() {
+			panic("a")
+		}, nil)
+		Ω(Start).Should(Panic())
+		assertLog("Initing -> Starting\nStarting -> Exited\nExit 10\n")
+	})
+
+	It("Set in wrong state", func() {
+		Start()
+		Ω(func() {
+			SetObserver(logObserver{})
+		}).Should(Panic())
+	})
+
+})
@@ -0,0 +1,77 @@
+package life
+
+import "fmt"
+
+// PanicAction tells what to do on a panic recovered from a callback, see
+// SetPanicPolicy().
+type PanicAction int
+
+const (
+	// PanicAbort aborts start or shutdown, the default.
+	PanicAbort PanicAction = iota
+
+	// PanicContinue logs the panic, reports to error handler, and continues
+	// as the callback returned normally.
+	PanicContinue
+)
+
+// Phase names passed to panic policy.
+const (
+	PanicInStart    = "start"
+	PanicInShutdown = "shutdown"
+)
+
+// see SetPanicPolicy(), nil means defaultPanicPolicy
+var panicPolicy func(phase, pkg string, recovered interface{}) PanicAction
+
+// SetPanicPolicy set the function decides what to do if onStart or
+// onShutdown callback of package pkg panics, phase is PanicInStart or
+// PanicInShutdown. The default policy aborts, except panics on shutdown
+// continue in BestEffort shutdown policy. Panics continued on shutdown are
+// returned by ShutdownError(). Can only be called in Initing state.
+func SetPanicPolicy(policy func(phase, pkg string, recovered interface{}) PanicAction) {
+	ensureStatef(Initing, "[%s] Can not set panic policy in \"%v\" state", tag, State())
+	panicPolicy = policy
+}
+
+func defaultPanicPolicy(phase, _ string, _ interface{}) PanicAction {
+	if phase == PanicInShutdown && shutdownPolicy == BestEffort {
+		return PanicContinue
+	}
+	return PanicAbort
+}
+
+// callGuarded calls callback fn of package name, on panic, re-panics or
+// continues according to panic policy.
+func callGuarded(phase, name string, fn Callback) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		publishEvent(Event{Kind: EventPackageFailed, Name: name, Err: toError(r)})
+
+		policy := panicPolicy
+		if policy == nil {
+			policy = defaultPanicPolicy
+		}
+		if policy(phase, name, r) != PanicContinue {
+			panic(r)
+		}
+
+		if phase == PanicInStart {
+			warnPkgf(name, "Start package %s failed: %v", name, r)
+		} else {
+			warnPkgf(name, "Shutdown package %s failed: %v", name, r)
+		}
+		errorHandler(nil, r)
+		if phase == PanicInShutdown {
+			shutdownErrsL.Lock()
+			shutdownErrs = append(shutdownErrs, fmt.Errorf("shutdown package %s: %v", name, r))
+			shutdownErrsL.Unlock()
+			addFailedPkg(name)
+		}
+	}()
+
+	wrapCallback(phase, name, fn)()
+}
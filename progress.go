@@ -0,0 +1,45 @@
+package life
+
+import "sync/atomic"
+
+// StartPhase is the phase of a package in StartEvent.
+type StartPhase int
+
+const (
+	// PackageStarting sent before calling onStart callback of the package.
+	PackageStarting StartPhase = iota
+
+	// PackageStarted sent after onStart callback of the package returned.
+	PackageStarted
+
+	// PackageFailed sent if onStart callback of the package panics.
+	PackageFailed
+)
+
+// StartEvent reports start progress of a package, see StartProgress().
+type StartEvent struct {
+	Package string
+	Phase   StartPhase
+}
+
+var progress = make(chan StartEvent, defaultEventBufferSize)
+
+// StartProgress returns the channel receiving StartEvent during Start(), the
+// channel closed after Start() complete, succeed or not. Events are sent
+// without blocking, dropped if channel buffer full, a slow consumer never
+// stalls startup, see SetEventBufferSize().
+func StartProgress() <-chan StartEvent {
+	return progress
+}
+
+func publishProgress(name string, phase StartPhase) {
+	// progress closed after Start(), StartPackage() not reported
+	if State() != Starting {
+		return
+	}
+	select {
+	case progress <- StartEvent{name, phase}:
+	default:
+		atomic.AddUint64(&droppedEvents, 1)
+	}
+}
@@ -0,0 +1,67 @@
+package life_test
+
+import (
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/hal"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("StartProgress", func() {
+
+	var readAll = func() (result []StartEvent) {
+		for e := range StartProgress() {
+			result = append(result, e)
+		}
+		return
+	}
+
+	BeforeEach(func() {
+		reset.Enable()
+		hal.Exit = func(int) {}
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Succeed", func() {
+		Register("a", nil, nil)
+		Register("b", nil, nil)
+		Start()
+		Ω(readAll()).Should(Equal([]StartEvent{
+			{"a", PackageStarting},
+			{"a", PackageStarted},
+			{"b", PackageStarting},
+			{"b", PackageStarted},
+		}))
+	})
+
+	It("Failed", func() {
+		Register("a", nil, nil)
+		Register("b", func() {
+			panic("b")
+		}, nil)
+		Register("c", nil, nil)
+		Ω(Start).Should(Panic())
+		Ω(readAll()).Should(Equal([]StartEvent{
+			{"a", PackageStarting},
+			{"a", PackageStarted},
+			{"b", PackageStarting},
+			{"b", PackageFailed},
+		}))
+	})
+
+	It("Live", func() {
+		events := StartProgress()
+		Register("a", func() {
+			Ω(<-events).Should(Equal(StartEvent{"a", PackageStarting}))
+		}, nil)
+		Start()
+		Ω(<-events).Should(Equal(StartEvent{"a", PackageStarted}))
+		Ω(events).Should(BeClosed())
+	})
+
+})
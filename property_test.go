@@ -0,0 +1,81 @@
+package life_test
+
+import (
+	"math/rand"
+
+	. "github.com/redforks/life"
+	"github.com/redforks/life/lifetest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Dependency sorting property", func() {
+
+	const runs = 100
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	dependsOf := func(fakes []lifetest.Fake) map[string][]string {
+		r := make(map[string][]string, len(fakes))
+		for _, f := range fakes {
+			r[f.Name] = f.Depends
+		}
+		return r
+	}
+
+	It("Dependencies start first, order stable", func() {
+		for seed := int64(0); seed < runs; seed++ {
+			r := rand.New(rand.NewSource(seed))
+			fakes := lifetest.RandomDAG(r, 1+r.Intn(20))
+			lifetest.NewHarness(fakes...)
+
+			order, err := StartOrder()
+			Ω(err).Should(Succeed(), "seed %d", seed)
+			Ω(order).Should(HaveLen(len(fakes)), "seed %d", seed)
+			pos := make(map[string]int, len(order))
+			for i, name := range order {
+				pos[name] = i
+			}
+			for name, depends := range dependsOf(fakes) {
+				for _, dep := range depends {
+					Ω(pos[dep]).Should(BeNumerically("<", pos[name]), "seed %d: %s depends on %s", seed, name, dep)
+				}
+			}
+			Ω(StartOrder()).Should(Equal(order), "seed %d", seed)
+
+			reset.Disable()
+			reset.Enable()
+		}
+	})
+
+	It("Cycles detected", func() {
+		for seed := int64(0); seed < runs; seed++ {
+			r := rand.New(rand.NewSource(seed))
+			fakes := lifetest.RandomDAG(r, 2+r.Intn(20))
+			lifetest.InjectCycle(r, fakes)
+			lifetest.NewHarness(fakes...)
+
+			err := CheckCycles()
+			Ω(err).Should(BeAssignableToTypeOf(&CycleError{}), "seed %d", seed)
+			cycle := err.(*CycleError).Cycle
+			Ω(len(cycle)).Should(BeNumerically(">=", 3), "seed %d", seed)
+			Ω(cycle[0]).Should(Equal(cycle[len(cycle)-1]), "seed %d", seed)
+			depends := dependsOf(fakes)
+			for i := 0; i < len(cycle)-1; i++ {
+				Ω(depends[cycle[i]]).Should(ContainElement(cycle[i+1]), "seed %d: %v", seed, cycle)
+			}
+
+			reset.Disable()
+			reset.Enable()
+		}
+	})
+
+})
@@ -0,0 +1,125 @@
+package life
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+)
+
+// environment variable tells the new process of ReExec() that the listener
+// inherited as file descriptor 3.
+const inheritListenerEnv = "LIFE_INHERIT_LISTENER"
+
+var (
+	// listener handed off to the new process, see RegisterListener()
+	reExecListener net.Listener
+
+	// see ReExecOn()
+	reExecSignal os.Signal
+
+	// arguments of the new process, replaceable for test
+	reExecArgs = func() []string {
+		return os.Args[1:]
+	}
+)
+
+// RegisterListener register the listener handed off to the new process by
+// ReExec(), the listener must have `File() (*os.File, error)' method, such as
+// *net.TCPListener and *net.UnixListener. Only one listener supported. Can
+// only be called in Initing state.
+func RegisterListener(ln net.Listener) {
+	ensureStatef(Initing, "[%s] Can not register listener in \"%v\" state", tag, State())
+	if reExecListener != nil {
+		log.Panicf("[%s] Listener already registered", tag)
+	}
+	reExecListener = ln
+}
+
+// InheritedListener returns the listener handed off by ReExec() of the old
+// process, returns nil if not started by ReExec(). The listener can only be
+// taken once, the environment variable marks it cleared, so child processes
+// of the new process not mistake their file descriptor 3 as listener.
+func InheritedListener() (net.Listener, error) {
+	if os.Getenv(inheritListenerEnv) != "1" {
+		return nil, nil
+	}
+	os.Unsetenv(inheritListenerEnv)
+
+	f := os.NewFile(3, "listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// ReExecOn set the signal triggers ReExec(), such as syscall.SIGUSR2. Can
+// only be called in Initing state.
+func ReExecOn(sig os.Signal) {
+	ensureStatef(Initing, "[%s] Can not set re-exec signal in \"%v\" state", tag, State())
+	reExecSignal = sig
+}
+
+// ReExec starts a new process of the same executable and arguments, hands off
+// the listener registered by RegisterListener(), then shutdown the current
+// process. The new process gets the listener by InheritedListener(). Returns
+// error and the current process keeps running if failed to start the new
+// process. ReExec never waits the new process, the current process is
+// expected to exit after shutdown, leaves the new process running. Can only
+// be called in Running state.
+func ReExec() error {
+	if st := State(); st != Running {
+		return fmt.Errorf("Can not re-exec in \"%v\" state", st)
+	}
+
+	ln, ok := reExecListener.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return fmt.Errorf("No listener can be handed off, see RegisterListener()")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	f, err := ln.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cmd := exec.Command(exe, reExecArgs()...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), inheritListenerEnv+"=1")
+	cmd.ExtraFiles = []*os.File{f}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	logf("Re-exec new process %d, start shutdown", cmd.Process.Pid)
+	Shutdown()
+	return nil
+}
+
+// watchReExec calls ReExec() on sig until done closed, retry on next signal
+// if failed.
+func watchReExec(sig os.Signal, done <-chan struct{}, ready *sync.WaitGroup) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig)
+	defer signal.Stop(c)
+	ready.Done()
+	for {
+		select {
+		case <-c:
+			logf("Receive %v signal, start re-exec", sig)
+			if err := ReExec(); err != nil {
+				warnf("Re-exec failed: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
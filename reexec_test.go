@@ -0,0 +1,110 @@
+package life_test
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("ReExec", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Not running", func() {
+		Ω(ReExec()).Should(MatchError(`Can not re-exec in "Initing" state`))
+	})
+
+	It("No listener", func() {
+		Start()
+		Ω(ReExec()).Should(MatchError("No listener can be handed off, see RegisterListener()"))
+		Ω(State()).Should(Equal(Running))
+	})
+
+	It("Register listener", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Ω(err).Should(Succeed())
+		defer ln.Close()
+
+		RegisterListener(ln)
+		Ω(func() {
+			RegisterListener(ln)
+		}).Should(matcher.Panics("[life] Listener already registered"))
+		Start()
+		Ω(func() {
+			RegisterListener(ln)
+		}).Should(matcher.Panics(`[life] Can not register listener in "Running" state`))
+	})
+
+	It("Not inherited", func() {
+		Ω(InheritedListener()).Should(BeNil())
+	})
+
+	It("Hand off listener", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Ω(err).Should(Succeed())
+		RegisterListener(ln)
+		defer SetReExecArgs("-test.run=^TestReExecChild$")()
+		Start()
+
+		Ω(ReExec()).Should(Succeed())
+		Ω(State()).Should(Equal(Halt))
+		Ω(ln.Close()).Should(Succeed())
+
+		// the listener still open in the new process, serves the connection
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		Ω(err).Should(Succeed())
+		defer conn.Close()
+		Ω(conn.SetDeadline(time.Now().Add(5 * time.Second))).Should(Succeed())
+		Ω(bufio.NewReader(conn).ReadString('\n')).Should(Equal("inherited\n"))
+	})
+
+})
+
+// TestReExecChild is the new process started by "Hand off listener" spec,
+// serves one connection on the inherited listener. Does nothing in normal
+// test run.
+func TestReExecChild(t *testing.T) {
+	ln, err := InheritedListener()
+	if ln == nil {
+		return
+	}
+	// keep the output of the parent clean
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if os.Getenv("LIFE_INHERIT_LISTENER") != "" {
+		t.Fatal("inherit listener environment not cleared")
+	}
+	if again, _ := InheritedListener(); again != nil {
+		t.Fatal("listener taken twice")
+	}
+	if err = ln.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("inherited\n")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+package life
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+)
+
+type reloader struct {
+	name string
+	fn   func() error
+}
+
+var (
+	// see RegisterReloader()
+	reloaders []reloader
+
+	// see ReloadOn()
+	reloadSignal os.Signal
+
+	// serializes Reload() calls
+	reloadL sync.Mutex
+)
+
+// RegisterReloader register reload function of package name, such as re-read
+// its config file. Reload functions run by Reload() in package start order.
+// Can only be called in Initing state.
+func RegisterReloader(name string, reload func() error) {
+	ensureStatef(Initing, "[%s] Can not register reloader \"%s\" in \"%v\" state", tag, name, State())
+	reloaders = append(reloaders, reloader{name, reload})
+}
+
+// ReloadOn set the signal triggers Reload(), such as syscall.SIGHUP. Can only
+// be called in Initing state.
+func ReloadOn(sig os.Signal) {
+	ensureStatef(Initing, "[%s] Can not set reload signal in \"%v\" state", tag, State())
+	reloadSignal = sig
+}
+
+// Reload runs all reload functions registered by RegisterReloader(), in
+// package start order, reloaders of not registered packages run last. A
+// failed reload function, returns error or panics, does not stop others, nor
+// the application, the package is expected to keep running with its old
+// config. Returns ErrorList of failed reload functions, nil if all succeed.
+// Can only be called in Running state.
+func Reload() error {
+	if st := State(); st != Running {
+		return fmt.Errorf("Can not reload in \"%v\" state", st)
+	}
+
+	reloadL.Lock()
+	defer reloadL.Unlock()
+
+	var errs ErrorList
+	for _, r := range sortReloaders() {
+		if err := callReloader(r); err != nil {
+			warnPkgf(r.name, "Reload package %s failed: %v", r.name, err)
+			errs = append(errs, fmt.Errorf("reload package %s: %v", r.name, err))
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// sortReloaders returns reloaders in start order of their packages.
+func sortReloaders() []reloader {
+	infoL.Lock()
+	pos := make(map[string]int, len(pkgs))
+	for i, p := range pkgs {
+		pos[normalizeName(p.name)] = i
+	}
+	infoL.Unlock()
+
+	order := func(r reloader) int {
+		if i, ok := pos[normalizeName(r.name)]; ok {
+			return i
+		}
+		return len(pos)
+	}
+	sorted := append([]reloader(nil), reloaders...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return order(sorted[i]) < order(sorted[j])
+	})
+	return sorted
+}
+
+func callReloader(r reloader) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = toError(v)
+		}
+	}()
+	debugPkgf(r.name, "Reload package %s", r.name)
+	return r.fn()
+}
+
+func watchReload(sig os.Signal, done <-chan struct{}, ready *sync.WaitGroup) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig)
+	defer signal.Stop(c)
+	ready.Done()
+	for {
+		select {
+		case <-c:
+			logf("Receive %v signal, reload", sig)
+			Reload()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package life_test
+
+import (
+	"errors"
+	"syscall"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Reload", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	reloadFunc := func(msg string, err error) func() error {
+		return func() error {
+			appendLog(msg)
+			return err
+		}
+	}
+
+	It("Not running", func() {
+		Ω(Reload()).Should(MatchError(`Can not reload in "Initing" state`))
+	})
+
+	It("Dependency order", func() {
+		Register("api", nil, nil, "db")
+		Register("db", nil, nil)
+		RegisterReloader("not-exist", reloadFunc("not-exist", nil))
+		RegisterReloader("api", reloadFunc("api", nil))
+		RegisterReloader("db", reloadFunc("db", nil))
+		Start()
+		Ω(Reload()).Should(Succeed())
+		assertLog("db\napi\nnot-exist\n")
+	})
+
+	It("Failure not stop others", func() {
+		Register("a", nil, nil)
+		Register("b", nil, nil)
+		Register("c", nil, nil)
+		RegisterReloader("a", func() error {
+			panic("a")
+		})
+		RegisterReloader("b", reloadFunc("b", errors.New("bad config")))
+		RegisterReloader("c", reloadFunc("c", nil))
+		Start()
+		Ω(Reload()).Should(MatchError("reload package a: a\nreload package b: bad config"))
+		assertLog("b\nc\n")
+		Ω(State()).Should(Equal(Running))
+	})
+
+	It("Wrong state", func() {
+		Start()
+		Ω(func() {
+			RegisterReloader("a", nil)
+		}).Should(matcher.Panics(`[life] Can not register reloader "a" in "Running" state`))
+		Ω(func() {
+			ReloadOn(syscall.SIGHUP)
+		}).Should(matcher.Panics(`[life] Can not set reload signal in "Running" state`))
+	})
+
+})
@@ -0,0 +1,470 @@
+//go:generate stringer -type=ShutdownCause -trimprefix=Cause
+
+package life
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultShutdownWarnRatio = 0.8
+
+var (
+	// max number of packages shutdown in parallel, see SetShutdownConcurrency()
+	shutdownConcurrency = 1
+
+	// see SetShutdownWarnRatio()
+	shutdownWarnRatio = defaultShutdownWarnRatio
+
+	// packages onShutdown not returned yet, guarded by pendingL
+	pendingL        sync.Mutex
+	pendingShutdown map[*pkg]bool
+)
+
+// SetShutdownConcurrency set max number of packages shutdown in parallel,
+// default 1, shutdown one by one in reversed start order. If n > 1,
+// independent packages shutdown in parallel, but a package shutdown only
+// after all packages depend on it shutdown. Observer must be safe to be
+// called concurrently. Can only be called in Initing state.
+//
+// If an onShutdown callback panics in FailFast policy, no more package
+// starts shutdown, in-flight ones run to complete, then the panic re-raised.
+func SetShutdownConcurrency(n int) {
+	ensureStatef(Initing, "[%s] Can not set shutdown concurrency in \"%v\" state", tag, State())
+	if n < 1 {
+		n = 1
+	}
+	shutdownConcurrency = n
+}
+
+// shutdownConcurrently shutdown pkgs, which are in start order, at most n
+// packages in parallel.
+func shutdownConcurrently(pkgs []*pkg, n int) {
+	dependents, depends := shutdownGraph(pkgs)
+	var ready []int
+	for i := range pkgs {
+		if dependents[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	type result struct {
+		i   int
+		err interface{}
+	}
+	done := make(chan result)
+	running := 0
+	var failed interface{}
+	for running > 0 || len(ready) > 0 && failed == nil {
+		for len(ready) > 0 && running < n && failed == nil {
+			next := nextShutdown(pkgs, ready)
+			i := ready[next]
+			ready = append(ready[:next], ready[next+1:]...)
+
+			running++
+			go func() {
+				defer func() {
+					done <- result{i, recover()}
+				}()
+				shutdownPackage(pkgs[i])
+			}()
+		}
+
+		r := <-done
+		running--
+		if r.err != nil && failed == nil {
+			failed = r.err
+		}
+		for _, d := range depends[r.i] {
+			dependents[d]--
+			if dependents[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if failed != nil {
+		panic(failed)
+	}
+}
+
+// shutdownGraph returns number of dependents and depended packages of each
+// package, in position of pkgs. A package of a lower rank or phase is treated
+// as depended by all packages of higher ones, to shutdown in reversed stage
+// order.
+func shutdownGraph(pkgs []*pkg) (dependents []int, depends [][]int) {
+	pos := make(map[string]int, len(pkgs))
+	for i, p := range pkgs {
+		pos[normalizeName(p.name)] = i
+		for _, alias := range p.aliases {
+			pos[normalizeName(alias)] = i
+		}
+	}
+
+	dependents = make([]int, len(pkgs))
+	depends = make([][]int, len(pkgs))
+	for i, p := range pkgs {
+		for _, name := range p.depends {
+			if d, exist := pos[normalizeName(name)]; exist {
+				dependents[d]++
+				depends[i] = append(depends[i], d)
+			}
+		}
+		for d, q := range pkgs {
+			if earlierStage(q, p) {
+				dependents[d]++
+				depends[i] = append(depends[i], d)
+			}
+		}
+	}
+	return dependents, depends
+}
+
+// earlierStage returns true if p starts in an earlier stage than q: a lower
+// rank, or a lower phase of the same rank.
+func earlierStage(p, q *pkg) bool {
+	if p.rank() != q.rank() {
+		return p.rank() < q.rank()
+	}
+	return p.phase < q.phase
+}
+
+// nextShutdown returns the index of ready, which are positions in pkgs, that
+// should shutdown first: the lowest shutdown priority, then the one started
+// last.
+func nextShutdown(pkgs []*pkg, ready []int) int {
+	r := 0
+	for j, i := range ready {
+		p, q := pkgs[i], pkgs[ready[r]]
+		if p.shutdownPriority < q.shutdownPriority ||
+			p.shutdownPriority == q.shutdownPriority && i > ready[r] {
+			r = j
+		}
+	}
+	return r
+}
+
+// shutdownSequence returns pkgs, which are in start order, in shutdown order:
+// a package shutdown after all packages depend on it, otherwise ordered by
+// nextShutdown(). Without shutdown priority, it is the reversed start order.
+func shutdownSequence(pkgs []*pkg) []*pkg {
+	dependents, depends := shutdownGraph(pkgs)
+	var ready []int
+	for i := range pkgs {
+		if dependents[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	result := make([]*pkg, 0, len(pkgs))
+	for len(ready) > 0 {
+		next := nextShutdown(pkgs, ready)
+		i := ready[next]
+		ready = append(ready[:next], ready[next+1:]...)
+		result = append(result, pkgs[i])
+		for _, d := range depends[i] {
+			dependents[d]--
+			if dependents[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	return result
+}
+
+// SetShutdownWarnRatio set when to warn slow shutdown, as a ratio of shutdown
+// timeout, default 0.8. If shutdown not complete when the time reached,
+// packages not shutdown yet are logged, to find out which package is slow
+// before killed by shutdown timeout. Zero disables the warning. Can only be
+// called in Initing state.
+func SetShutdownWarnRatio(r float64) {
+	ensureStatef(Initing, "[%s] Can not set shutdown warn ratio in \"%v\" state", tag, State())
+	shutdownWarnRatio = r
+}
+
+// warnSlowShutdown starts tracking of shutdown of pkgs, returns function to
+// stop it.
+func warnSlowShutdown(pkgs []*pkg) func() {
+	if shutdownWarnRatio <= 0 {
+		return func() {}
+	}
+
+	pendingL.Lock()
+	pendingShutdown = make(map[*pkg]bool, len(pkgs))
+	for _, p := range pkgs {
+		pendingShutdown[p] = true
+	}
+	pendingL.Unlock()
+
+	timeout := shutdownTimeout
+	d := time.Duration(float64(timeout) * shutdownWarnRatio)
+	// closed when the warning done, the stop function waits it, not to
+	// race with later shutdown or reset
+	warned := make(chan struct{})
+	timer := time.AfterFunc(d, func() {
+		defer close(warned)
+		var names []string
+		pendingL.Lock()
+		for i := len(pkgs) - 1; i >= 0; i-- {
+			if pendingShutdown[pkgs[i]] {
+				names = append(names, pkgs[i].name)
+			}
+		}
+		pendingL.Unlock()
+		warnf("Shutdown not complete in %v, timeout %v, packages not shutdown: %s", d, timeout, strings.Join(names, ", "))
+	})
+
+	return func() {
+		if !timer.Stop() {
+			<-warned
+		}
+		pendingL.Lock()
+		pendingShutdown = nil
+		pendingL.Unlock()
+	}
+}
+
+// markShutdownDone records onShutdown of p returned, see warnSlowShutdown().
+func markShutdownDone(p *pkg) {
+	pendingL.Lock()
+	defer pendingL.Unlock()
+	delete(pendingShutdown, p)
+}
+
+// ShutdownCause tells what triggered the shutdown.
+type ShutdownCause int
+
+const (
+	// CauseNone means not shutdown yet.
+	CauseNone ShutdownCause = iota
+
+	// CauseProgrammatic means Shutdown() called by application.
+	CauseProgrammatic
+
+	// CauseSignal means SIGINT or SIGTERM received.
+	CauseSignal
+
+	// CauseChannel means a channel of ShutdownOn() closed.
+	CauseChannel
+
+	// CauseStartFailure means an onStart callback panics.
+	CauseStartFailure
+
+	// CauseIdle means idle for the period of RegisterIdleShutdown().
+	CauseIdle
+)
+
+// ShutdownInfo describes how the application shutdown, see WaitToEndInfo().
+type ShutdownInfo struct {
+	Cause ShutdownCause
+
+	// Signal triggered the shutdown, nil if Cause is not CauseSignal.
+	Signal os.Signal
+
+	// DrainTime is the time spent in Draining state.
+	DrainTime time.Duration
+
+	// GateTimeout is true if shutdown gates not open in shutdown timeout.
+	GateTimeout bool
+
+	// Failed are names of packages failed to shutdown, in shutdown order.
+	Failed []string
+}
+
+var (
+	// guards shutdownCause, shutdownSignal and gateTimeout
+	causeL         sync.Mutex
+	shutdownCause  ShutdownCause
+	shutdownSignal os.Signal
+	gateTimeout    bool
+
+	// names of packages failed to shutdown, guarded by shutdownErrsL
+	failedPkgs []string
+)
+
+// setShutdownCause records what triggered the shutdown, the first one wins.
+func setShutdownCause(c ShutdownCause, sig os.Signal) {
+	causeL.Lock()
+	defer causeL.Unlock()
+	if shutdownCause == CauseNone {
+		shutdownCause, shutdownSignal = c, sig
+	}
+}
+
+func setGateTimeout() {
+	causeL.Lock()
+	defer causeL.Unlock()
+	gateTimeout = true
+}
+
+func addFailedPkg(name string) {
+	shutdownErrsL.Lock()
+	defer shutdownErrsL.Unlock()
+	failedPkgs = append(failedPkgs, name)
+}
+
+// ShutdownReason returns what triggered the shutdown, CauseNone if not
+// shutdown yet. Query it in BeforeShutingdown hooks and onShutdown callbacks to
+// behave differently, such as on signal or on Shutdown() call. There is no
+// cause for shutdown gates, gates only delay a shutdown started by others,
+// see ShutdownInfo.GateTimeout for gates not opened in time.
+func ShutdownReason() ShutdownCause {
+	causeL.Lock()
+	defer causeL.Unlock()
+	return shutdownCause
+}
+
+// WaitToEndInfo like WaitToEnd(), returns how the application shutdown.
+func WaitToEndInfo() ShutdownInfo {
+	WaitToEnd()
+
+	var r ShutdownInfo
+	causeL.Lock()
+	r.Cause, r.Signal, r.GateTimeout = shutdownCause, shutdownSignal, gateTimeout
+	causeL.Unlock()
+
+	shutdownErrsL.Lock()
+	r.Failed = append([]string(nil), failedPkgs...)
+	shutdownErrsL.Unlock()
+
+	if drain, ok := StateEnteredAt(Draining); ok {
+		if end, ok := StateEnteredAt(Shutingdown); ok {
+			r.DrainTime = end.Sub(drain)
+		}
+	}
+	return r
+}
+
+// logShutdownSummary logs uptime from Running to Shutingdown, number of
+// packages shutdown, and time spent in Draining state, on clean shutdown.
+func logShutdownSummary() {
+	var uptime, drain time.Duration
+	end, _ := StateEnteredAt(Shutingdown)
+	if running, ok := StateEnteredAt(Running); ok {
+		uptime = end.Sub(running)
+	}
+	if begin, ok := StateEnteredAt(Draining); ok {
+		drain = end.Sub(begin)
+	}
+
+	stopped := 0
+	infoL.Lock()
+	for _, p := range pkgs {
+		if p.stopped {
+			stopped++
+		}
+	}
+	infoL.Unlock()
+	logf("Shutdown complete: uptime %v, %d packages shutdown, drain %v", uptime, stopped, drain)
+}
+
+func resetShutdownInfo() {
+	causeL.Lock()
+	shutdownCause, shutdownSignal, gateTimeout = CauseNone, nil, false
+	causeL.Unlock()
+
+	shutdownErrsL.Lock()
+	failedPkgs = nil
+	shutdownErrsL.Unlock()
+}
+
+var (
+	// see SetShutdownBudget()
+	shutdownBudget time.Duration
+
+	// guards shutdownCtx, shutdownCancel and signalExitAt
+	shutdownCtxL   sync.Mutex
+	shutdownCtx                       = context.Background()
+	shutdownCancel context.CancelFunc = func() {}
+
+	// time of forced exit if shutdown by signal, see handleSignals()
+	signalExitAt time.Time
+)
+
+// SetShutdownBudget set max duration of the whole Shutdown(), including
+// shutdown gates, drain, hooks and onShutdown callbacks, default 0 means no
+// overall limit. Hooks and gates time out earlier if the budget runs out, the
+// remaining time flows to onShutdown callbacks by ShutdownContext(). Can only
+// be called in Initing state.
+func SetShutdownBudget(d time.Duration) {
+	ensureStatef(Initing, "[%s] Can not set shutdown budget in \"%v\" state", tag, State())
+	shutdownBudget = d
+}
+
+// ShutdownContext returns the context of current shutdown, its deadline is
+// the end of shutdown budget if SetShutdownBudget() called, done after
+// shutdown complete. Returns context.Background() before shutdown.
+func ShutdownContext() context.Context {
+	shutdownCtxL.Lock()
+	defer shutdownCtxL.Unlock()
+	return shutdownCtx
+}
+
+// ShutdownDeadline returns the time shutdown must complete, the earlier of
+// the end of shutdown budget, and the forced exit after shutdown timeout if
+// shutdown by signal. Returns false if shutdown is not bounded, or not
+// shutdown yet. onShutdown callbacks use it to size their own drain.
+func ShutdownDeadline() (time.Time, bool) {
+	deadline, ok := ShutdownContext().Deadline()
+
+	shutdownCtxL.Lock()
+	exitAt := signalExitAt
+	shutdownCtxL.Unlock()
+	if !exitAt.IsZero() && (!ok || exitAt.Before(deadline)) {
+		return exitAt, true
+	}
+	return deadline, ok
+}
+
+// setSignalExitAt records the time of forced exit of signal shutdown.
+func setSignalExitAt(t time.Time) {
+	shutdownCtxL.Lock()
+	defer shutdownCtxL.Unlock()
+	signalExitAt = t
+}
+
+// beginShutdownBudget creates the shutdown context, returns the function
+// cancels it.
+func beginShutdownBudget() func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if shutdownBudget > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), shutdownBudget)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	shutdownCtxL.Lock()
+	defer shutdownCtxL.Unlock()
+	shutdownCtx, shutdownCancel = ctx, cancel
+	return cancel
+}
+
+// budgetTimeout returns d, or the remaining shutdown budget if less.
+func budgetTimeout(d time.Duration) time.Duration {
+	deadline, ok := ShutdownContext().Deadline()
+	if !ok {
+		return d
+	}
+
+	if r := time.Until(deadline); r < d {
+		if r < 0 {
+			return 0
+		}
+		return r
+	}
+	return d
+}
+
+func resetShutdownContext() {
+	shutdownCtxL.Lock()
+	defer shutdownCtxL.Unlock()
+	shutdownCancel()
+	shutdownCtx, shutdownCancel = context.Background(), func() {}
+	signalExitAt = time.Time{}
+}
@@ -0,0 +1,377 @@
+package life_test
+
+import (
+	"bytes"
+	stdlog "log"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/hal"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Shutdown concurrency", func() {
+
+	var (
+		l   sync.Mutex
+		log []string
+	)
+
+	record := func(msg string) {
+		l.Lock()
+		defer l.Unlock()
+		log = append(log, msg)
+	}
+
+	slow := func(name string) Callback {
+		return func() {
+			record(name + " begin")
+			time.Sleep(20 * time.Millisecond)
+			record(name + " end")
+		}
+	}
+
+	BeforeEach(func() {
+		reset.Enable()
+		log = nil
+		hal.Exit = func(n int) {
+			record("Exit " + strconv.Itoa(n))
+		}
+		SetShutdownConcurrency(2)
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Independent packages in parallel", func() {
+		Register("a", nil, slow("a"))
+		Register("b", nil, slow("b"))
+		Start()
+		start := time.Now()
+		Shutdown()
+		Ω(time.Since(start)).Should(BeNumerically("<", 35*time.Millisecond))
+		Ω(log[:2]).Should(ConsistOf("a begin", "b begin"))
+		Ω(log[2:]).Should(ConsistOf("a end", "b end"))
+	})
+
+	It("Dependents shutdown first", func() {
+		Register("a", nil, slow("a"), "c")
+		Register("b", nil, slow("b"), "c")
+		Register("c", nil, slow("c"))
+		Start()
+		Shutdown()
+		Ω(log).Should(HaveLen(6))
+		Ω(log[4:]).Should(Equal([]string{"c begin", "c end"}))
+	})
+
+	It("StartFirst and phases shutdown in reversed stage", func() {
+		RegisterWithOpts("log", nil, slow("log"), RegisterOpts{StartFirst: true})
+		RegisterWithOpts("db", nil, slow("db"), RegisterOpts{Phase: 1})
+		Register("cache", nil, slow("cache"))
+		RegisterWithOpts("api", nil, slow("api"), RegisterOpts{StartLast: true, ShutdownPriority: 1})
+		Start()
+		Shutdown()
+		Ω(log).Should(Equal([]string{
+			"api begin", "api end",
+			"db begin", "db end",
+			"cache begin", "cache end",
+			"log begin", "log end",
+		}))
+	})
+
+	It("Limited", func() {
+		SetShutdownConcurrency(1)
+		Register("a", nil, slow("a"))
+		Register("b", nil, slow("b"))
+		Start()
+		Shutdown()
+		Ω(log).Should(Equal([]string{"b begin", "b end", "a begin", "a end"}))
+	})
+
+	It("Panic waits in-flight shutdown", func() {
+		Register("a", nil, slow("a"))
+		Register("b", nil, func() {
+			panic("b")
+		})
+		Register("c", nil, nil, "a", "b")
+		Start()
+		Ω(Shutdown).Should(matcher.Panics("b"))
+		Ω(log).Should(Equal([]string{"a begin", "a end", "Exit 11"}))
+	})
+
+	It("BestEffort", func() {
+		SetShutdownPolicy(BestEffort)
+		Register("a", nil, slow("a"))
+		Register("b", nil, func() {
+			panic("b")
+		})
+		Register("c", nil, func() {
+			panic("c")
+		})
+		Start()
+		Shutdown()
+		Ω(ShutdownError()).Should(HaveLen(2))
+		Ω(log).Should(Equal([]string{"a begin", "a end"}))
+	})
+
+})
+
+var _ = Describe("Shutdown warning", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		SetShutdownTimeout(50 * time.Millisecond)
+		SetShutdownWarnRatio(0.2)
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Log packages not shutdown", func() {
+		var buf bytes.Buffer
+		w, done := newLogWaiter(&buf, "packages not shutdown")
+		stdlog.SetOutput(w)
+		defer stdlog.SetOutput(os.Stderr)
+
+		Register("a", nil, func() {
+			<-done
+		})
+		Register("b", nil, nil)
+		Register("c", nil, func() {
+			<-done
+		})
+		Register("d", nil, nil)
+		SetShutdownConcurrency(4)
+		Start()
+		Shutdown()
+		Ω(buf.String()).Should(ContainSubstring("[life] Shutdown not complete in 10ms, timeout 50ms, packages not shutdown: c, a\n"))
+	})
+
+	It("Disabled", func() {
+		var buf bytes.Buffer
+		stdlog.SetOutput(&buf)
+		defer stdlog.SetOutput(os.Stderr)
+
+		SetShutdownWarnRatio(0)
+		Register("a", nil, func() {
+			time.Sleep(20 * time.Millisecond)
+		})
+		Start()
+		Shutdown()
+		Ω(buf.String()).ShouldNot(ContainSubstring("packages not shutdown"))
+	})
+
+})
+
+var _ = Describe("WaitToEndInfo", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		hal.Exit = func(int) {}
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Programmatic", func() {
+		Start()
+		Shutdown()
+		Ω(WaitToEndInfo()).Should(Equal(ShutdownInfo{Cause: CauseProgrammatic}))
+	})
+
+	It("Channel", func() {
+		ch := make(chan struct{})
+		ShutdownOn(ch)
+		Start()
+		close(ch)
+		info := WaitToEndInfo()
+		Ω(info.Cause).Should(Equal(CauseChannel))
+		Ω(info.Cause.String()).Should(Equal("Channel"))
+	})
+
+	It("Signal", func() {
+		Start()
+		sigs := make(chan os.Signal, 1)
+		sigs <- syscall.SIGTERM
+		HandleSignals(sigs, time.After)
+		info := WaitToEndInfo()
+		Ω(info.Cause).Should(Equal(CauseSignal))
+		Ω(info.Signal).Should(Equal(syscall.SIGTERM))
+	})
+
+	It("Drain time, gate timeout and failed packages", func() {
+		SetShutdownPolicy(BestEffort)
+		SetShutdownTimeout(10 * time.Millisecond)
+		SetDrainTime(5 * time.Millisecond)
+		RegisterShutdownGate("never", func() bool {
+			return false
+		})
+		Register("a", nil, func() {
+			panic("a")
+		})
+		Register("b", nil, nil)
+		Register("c", nil, func() {
+			panic("c")
+		})
+		Start()
+		Shutdown()
+
+		info := WaitToEndInfo()
+		Ω(info.Cause).Should(Equal(CauseProgrammatic))
+		Ω(info.GateTimeout).Should(BeTrue())
+		Ω(info.DrainTime).Should(BeNumerically(">=", 5*time.Millisecond))
+		Ω(info.Failed).Should(Equal([]string{"c", "a"}))
+	})
+
+	It("ShutdownReason", func() {
+		var reasons []ShutdownCause
+		RegisterHook("reason", 0, BeforeShutingdown, func() {
+			reasons = append(reasons, ShutdownReason())
+		})
+		Register("a", nil, func() {
+			reasons = append(reasons, ShutdownReason())
+		})
+		ch := make(chan struct{})
+		ShutdownOn(ch)
+		Ω(ShutdownReason()).Should(Equal(CauseNone))
+		Start()
+		close(ch)
+		WaitToEnd()
+		Ω(reasons).Should(Equal([]ShutdownCause{CauseChannel, CauseChannel}))
+	})
+
+	It("Failed in FailFast", func() {
+		Register("a", nil, func() {
+			panic("a")
+		})
+		Start()
+		Ω(Shutdown).Should(Panic())
+		Ω(WaitToEndInfo().Failed).Should(Equal([]string{"a"}))
+	})
+
+})
+
+var _ = Describe("Shutdown budget", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Bounds hooks and drain", func() {
+		var buf bytes.Buffer
+		w, done := newLogWaiter(&buf, "Done slow")
+		stdlog.SetOutput(w)
+		defer stdlog.SetOutput(os.Stderr)
+
+		var (
+			remain  time.Duration
+			hasDead bool
+		)
+		hold := make(chan struct{})
+		SetShutdownBudget(100 * time.Millisecond)
+		SetDrainTime(50 * time.Millisecond)
+		RegisterHook("slow", 0, BeforeShutingdown, func() {
+			<-hold
+		})
+		Register("a", nil, func() {
+			var deadline time.Time
+			deadline, hasDead = ShutdownContext().Deadline()
+			remain = time.Until(deadline)
+		})
+		Start()
+		Ω(ShutdownContext().Done()).Should(BeNil())
+
+		begin := time.Now()
+		Shutdown()
+		Ω(time.Since(begin)).Should(BeNumerically("<", 500*time.Millisecond))
+		Ω(buf.String()).Should(ContainSubstring(`[life] BeforeShutingdown hook timeout while running "slow"`))
+		Ω(hasDead).Should(BeTrue())
+		Ω(remain).Should(BeNumerically("<=", 0))
+		Ω(ShutdownContext().Err()).Should(HaveOccurred())
+
+		close(hold)
+		<-done
+	})
+
+	It("No budget", func() {
+		var hasDead bool
+		Register("a", nil, func() {
+			_, hasDead = ShutdownContext().Deadline()
+		})
+		Start()
+		Shutdown()
+		Ω(hasDead).Should(BeFalse())
+	})
+
+	It("Set in wrong state", func() {
+		Start()
+		Ω(func() {
+			SetShutdownBudget(time.Second)
+		}).Should(matcher.Panics(`[life] Can not set shutdown budget in "Running" state`))
+	})
+
+})
+
+var _ = Describe("ShutdownDeadline", func() {
+
+	var (
+		deadline    time.Time
+		hasDeadline bool
+	)
+
+	BeforeEach(func() {
+		reset.Enable()
+		hasDeadline = false
+		Register("a", nil, func() {
+			deadline, hasDeadline = ShutdownDeadline()
+		})
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Not bounded", func() {
+		Start()
+		_, ok := ShutdownDeadline()
+		Ω(ok).Should(BeFalse())
+		Shutdown()
+		Ω(hasDeadline).Should(BeFalse())
+	})
+
+	It("Budget", func() {
+		SetShutdownBudget(time.Hour)
+		Start()
+		Shutdown()
+		Ω(hasDeadline).Should(BeTrue())
+		Ω(deadline).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+	})
+
+	It("Signal", func() {
+		hal.Exit = func(int) {}
+		SetShutdownBudget(time.Hour)
+		SetShutdownTimeout(time.Minute)
+		Start()
+		sigs := make(chan os.Signal, 1)
+		sigs <- syscall.SIGTERM
+		HandleSignals(sigs, time.After)
+		Ω(hasDeadline).Should(BeTrue())
+		Ω(deadline).Should(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+	})
+
+})
@@ -0,0 +1,219 @@
+package life_test
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/hal"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Signal", func() {
+
+	var (
+		sigs    chan os.Signal
+		timeout chan time.Time
+		delay   chan time.Time
+		exits   chan int
+		handled chan struct{}
+	)
+
+	// pre-shutdown delay in test, distinguished from shutdown timeout
+	const preShutdownDelay = time.Hour
+
+	after := func(d time.Duration) <-chan time.Time {
+		if d == preShutdownDelay {
+			return delay
+		}
+		return timeout
+	}
+
+	// handle signals in background, AfterEach waits it done
+	handle := func() {
+		handled = make(chan struct{})
+		go func() {
+			defer close(handled)
+			HandleSignals(sigs, after)
+		}()
+	}
+
+	BeforeEach(func() {
+		reset.Enable()
+		sigs = make(chan os.Signal, 1)
+		timeout = make(chan time.Time)
+		delay = make(chan time.Time)
+		exits = make(chan int, 2)
+		hal.Exit = func(n int) {
+			exits <- n
+		}
+	})
+
+	AfterEach(func() {
+		if handled != nil {
+			Eventually(handled).Should(BeClosed())
+			handled = nil
+		}
+		reset.Disable()
+	})
+
+	It("Shutdown on signal", func() {
+		Register("pkg", nil, nil)
+		Start()
+		handle()
+		sigs <- syscall.SIGTERM
+		Eventually(exits).Should(Receive(Equal(1)))
+		Ω(State()).Should(Equal(Exited))
+		Ω(ExitCode()).Should(Equal(1))
+	})
+
+	Context("Signal during start", func() {
+		var log []string
+
+		record := func(msg string) Callback {
+			return func() {
+				log = append(log, msg)
+			}
+		}
+
+		signal := func() {
+			sigs <- syscall.SIGTERM
+			Eventually(IsStartCancelled).Should(BeTrue())
+		}
+
+		BeforeEach(func() {
+			log = nil
+			Register("a", record("a"), record("~a"))
+			handle()
+		})
+
+		It("Cancel start", func() {
+			Register("b", func() {
+				record("b")()
+				signal()
+			}, record("~b"), "a")
+			Register("c", record("c"), record("~c"), "b")
+			Start()
+			Ω(log).Should(Equal([]string{"a", "b", "~b", "~a"}))
+			Ω(exits).Should(Receive(Equal(1)))
+			Ω(State()).Should(Equal(Exited))
+			Ω(ExitCode()).Should(Equal(1))
+			WaitToEnd()
+			Consistently(exits).ShouldNot(Receive())
+		})
+
+		It("Signal in the last package", func() {
+			RegisterHook("running", 0, BeforeRunning, HookFunc(record("running")))
+			Register("b", signal, record("~b"), "a")
+			Start()
+			Ω(log).Should(Equal([]string{"a", "~b", "~a"}))
+			Ω(exits).Should(Receive(Equal(1)))
+		})
+
+		Context("Start hangs", func() {
+			var hold, started chan struct{}
+
+			BeforeEach(func() {
+				hold, started = make(chan struct{}), make(chan struct{})
+				Register("b", func() {
+					record("b")()
+					signal()
+					close(started)
+					<-hold
+				}, record("~b"), "a")
+				go Start()
+				<-started
+			})
+
+			AfterEach(func() {
+				close(hold)
+				Eventually(exits).Should(Receive(Equal(1)))
+				Ω(log).Should(Equal([]string{"a", "b", "~b", "~a"}))
+			})
+
+			It("Second signal forces exit", func() {
+				sigs <- os.Interrupt
+				Eventually(exits).Should(Receive(Equal(1)))
+				Ω(State()).Should(Equal(Exited))
+				Ω(ExitCode()).Should(Equal(1))
+			})
+
+			It("Timeout forces exit", func() {
+				Consistently(exits).ShouldNot(Receive())
+				timeout <- time.Now()
+				Eventually(exits).Should(Receive(Equal(1)))
+				Ω(State()).Should(Equal(Exited))
+			})
+
+		})
+
+	})
+
+	Context("Pre-shutdown delay", func() {
+
+		BeforeEach(func() {
+			SetPreShutdownDelay(preShutdownDelay)
+			Register("pkg", nil, nil)
+			Start()
+			Ω(Ready()).Should(BeTrue())
+			handle()
+			sigs <- syscall.SIGTERM
+			Eventually(Ready).Should(BeFalse())
+		})
+
+		It("Shutdown after delay", func() {
+			Consistently(State).Should(Equal(Running))
+			delay <- time.Now()
+			Eventually(exits).Should(Receive(Equal(1)))
+			Ω(ShutdownReason()).Should(Equal(CauseSignal))
+		})
+
+		It("Second signal exits immediately", func() {
+			sigs <- os.Interrupt
+			Eventually(exits).Should(Receive(Equal(1)))
+			Ω(State()).Should(Equal(Exited))
+		})
+
+	})
+
+	Context("Slow shutdown", func() {
+		var hold chan struct{}
+
+		BeforeEach(func() {
+			hold = make(chan struct{})
+			Register("slow", nil, func() {
+				<-hold
+			})
+			Start()
+			handle()
+			sigs <- syscall.SIGTERM
+			Eventually(State).Should(Equal(Shutingdown))
+		})
+
+		AfterEach(func() {
+			close(hold)
+			Eventually(State).Should(Equal(Halt))
+		})
+
+		It("Second signal forces exit", func() {
+			sigs <- os.Interrupt
+			Eventually(exits).Should(Receive(Equal(1)))
+			Ω(State()).Should(Equal(Exited))
+			Ω(ExitCode()).Should(Equal(1))
+		})
+
+		It("Timeout forces exit", func() {
+			Consistently(exits).ShouldNot(Receive())
+			timeout <- time.Now()
+			Eventually(exits).Should(Receive(Equal(1)))
+			Ω(State()).Should(Equal(Exited))
+			Ω(ExitCode()).Should(Equal(1))
+		})
+
+	})
+
+})
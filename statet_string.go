@@ -4,9 +4,9 @@ package life
 
 import "fmt"
 
-const _stateT_name = "InitingStartingRunningShutingdownhalt"
+const _stateT_name = "InitingStartingRunningDrainingShutingdownhaltExited"
 
-var _stateT_index = [...]uint8{0, 7, 15, 22, 33, 37}
+var _stateT_index = [...]uint8{0, 7, 15, 22, 30, 41, 45, 51}
 
 func (i StateT) String() string {
 	if i < 0 || i+1 >= StateT(len(_stateT_index)) {
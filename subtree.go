@@ -0,0 +1,205 @@
+package life
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ShutdownPackage shutdown package name and all packages depend on it,
+// directly or indirectly, in reversed start order, other packages keep
+// running, such as to disable a feature at runtime. Shutdown packages are no
+// longer started, skipped by Shutdown(), start them again by StartPackage().
+// Returns error if not in Running state, the package not registered or not
+// running, or onShutdown callbacks panic, even if continued by BestEffort
+// shutdown policy or panic policy. Failures are not part of the outcome of
+// the whole shutdown, such as ShutdownError(). Can not be called inside
+// callbacks.
+func ShutdownPackage(name string) (err error) {
+	if atomic.LoadInt64(&lockOwner) == goid() {
+		return fmt.Errorf("Can not shutdown package \"%s\" inside callback", name)
+	}
+	lock()
+	defer unlock()
+
+	if state != Running {
+		return fmt.Errorf("Can not shutdown package \"%s\" in \"%v\" state", name, state)
+	}
+	g, _ := newDepGraph(pkgs, nil)
+	p := g.pkgMap[normalizeName(name)]
+	if p == nil {
+		return fmt.Errorf("package '%s' not registered", name)
+	}
+
+	affected := make(map[*pkg]bool)
+	var visit func(p *pkg)
+	visit = func(p *pkg) {
+		if !affected[p] {
+			affected[p] = true
+			for _, d := range g.dependents[p] {
+				visit(d)
+			}
+		}
+	}
+	visit(p)
+	var list []*pkg
+	for _, q := range startedPackages(pkgs) {
+		if affected[q] {
+			list = append(list, q)
+		}
+	}
+	if len(list) == 0 || list[0] != p {
+		return fmt.Errorf("package '%s' not running", name)
+	}
+
+	names := make([]string, len(list))
+	for i, q := range list {
+		names[i] = q.name
+	}
+	logf("Shutdown package %s and its dependents: %s", name, strings.Join(names, ", "))
+	errsMark, failedMark := shutdownFailuresMark()
+	defer func() {
+		markStopped(list)
+		errs := takeShutdownFailures(errsMark, failedMark)
+		if r := recover(); r != nil {
+			err = fmt.Errorf("shutdown package %s: %v", name, r)
+		} else if len(errs) != 0 {
+			err = errs
+		}
+	}()
+	doShutdownPackages(list)
+	return nil
+}
+
+// shutdownFailuresMark returns number of recorded shutdown errors and failed
+// packages, see takeShutdownFailures().
+func shutdownFailuresMark() (errs, failed int) {
+	shutdownErrsL.Lock()
+	defer shutdownErrsL.Unlock()
+	return len(shutdownErrs), len(failedPkgs)
+}
+
+// takeShutdownFailures removes shutdown errors and failed packages recorded
+// after the mark returned by shutdownFailuresMark(), returns removed errors.
+func takeShutdownFailures(errsMark, failedMark int) ErrorList {
+	shutdownErrsL.Lock()
+	defer shutdownErrsL.Unlock()
+	r := append(ErrorList(nil), shutdownErrs[errsMark:]...)
+	shutdownErrs = shutdownErrs[:errsMark]
+	failedPkgs = failedPkgs[:failedMark]
+	return r
+}
+
+// StartPackage starts package name and its dependencies not started yet,
+// directly or indirectly, in start order, such as to enable a feature
+// disabled by ShutdownPackage(). Returns error if not in Running state, the
+// package not registered or already started, a package to start depends on
+// a package not registered, or an onStart callback panics; packages started
+// before the failure keep running. Can not be called inside callbacks.
+func StartPackage(name string) (err error) {
+	if atomic.LoadInt64(&lockOwner) == goid() {
+		return fmt.Errorf("Can not start package \"%s\" inside callback", name)
+	}
+	lock()
+	defer unlock()
+
+	if state != Running {
+		return fmt.Errorf("Can not start package \"%s\" in \"%v\" state", name, state)
+	}
+	g, _ := newDepGraph(pkgs, nil)
+	p := g.pkgMap[normalizeName(name)]
+	if p == nil {
+		return fmt.Errorf("package '%s' not registered", name)
+	}
+
+	started := make(map[*pkg]bool)
+	for _, q := range startedPackages(pkgs) {
+		started[q] = true
+	}
+	if started[p] {
+		return fmt.Errorf("package '%s' already started", name)
+	}
+
+	needed := make(map[*pkg]bool)
+	var visit func(p *pkg) error
+	visit = func(p *pkg) error {
+		if needed[p] || started[p] {
+			return nil
+		}
+		needed[p] = true
+		for _, dep := range p.depends {
+			q := g.pkgMap[normalizeName(dep)]
+			if q == nil {
+				return fmt.Errorf("package '%s' depends on '%s' not registered", p.name, dep)
+			}
+			if err := visit(q); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(p); err != nil {
+		return err
+	}
+
+	// pkgs are in start order after Start()
+	var list []*pkg
+	for _, q := range pkgs {
+		if needed[q] {
+			list = append(list, q)
+		}
+	}
+	names := make([]string, len(list))
+	for i, q := range list {
+		names[i] = q.name
+	}
+	logf("Start package %s and its dependencies: %s", name, strings.Join(names, ", "))
+
+	var starting *pkg
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("start package %s: %v", starting.name, r)
+		}
+	}()
+	for _, q := range list {
+		starting = q
+		infoL.Lock()
+		q.stopped = false
+		infoL.Unlock()
+		startPackage(q)
+	}
+	return nil
+}
+
+// startedPackages returns packages of list started and not shutdown by
+// ShutdownPackage().
+func startedPackages(list []*pkg) []*pkg {
+	infoL.Lock()
+	defer infoL.Unlock()
+
+	r := make([]*pkg, 0, len(list))
+	for _, p := range list {
+		if p.started {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+// markStopped marks packages of list shutdown by ShutdownPackage() as not
+// started, so they can start again. Their late shutdown callbacks are done,
+// dropped.
+func markStopped(list []*pkg) {
+	infoL.Lock()
+	defer infoL.Unlock()
+	lateL.Lock()
+	defer lateL.Unlock()
+
+	for _, p := range list {
+		if p.stopped {
+			p.started = false
+			p.startedCh = make(chan struct{})
+			p.lateShutdown = nil
+		}
+	}
+}
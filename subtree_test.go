@@ -0,0 +1,144 @@
+package life_test
+
+import (
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Subtree", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+		slog = ""
+		Register("a", newLogFunc("a"), newLogFunc("~a"))
+		Register("b", newLogFunc("b"), newLogFunc("~b"), "a")
+		Register("c", newLogFunc("c"), newLogFunc("~c"), "b")
+		Register("d", newLogFunc("d"), newLogFunc("~d"), "a")
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	Context("ShutdownPackage", func() {
+
+		It("Shutdown dependents first", func() {
+			Start()
+			assertLog("a\nb\nc\nd\n")
+			Ω(ShutdownPackage("b")).Should(Succeed())
+			assertLog("~c\n~b\n")
+			Ω(State()).Should(Equal(Running))
+			Ω(PackageStartedChan("b")).ShouldNot(BeClosed())
+			Ω(PackageStartedChan("d")).Should(BeClosed())
+
+			Shutdown()
+			assertLog("~d\n~a\n")
+		})
+
+		It("Not running", func() {
+			Start()
+			Ω(ShutdownPackage("b")).Should(Succeed())
+			Ω(ShutdownPackage("c")).Should(MatchError("package 'c' not running"))
+		})
+
+		It("Not registered", func() {
+			Start()
+			Ω(ShutdownPackage("x")).Should(MatchError("package 'x' not registered"))
+		})
+
+		It("Wrong state", func() {
+			Ω(ShutdownPackage("a")).Should(MatchError(`Can not shutdown package "a" in "Initing" state`))
+		})
+
+		It("Shutdown failed", func() {
+			failed := false
+			Register("e", nil, func() {
+				if !failed {
+					failed = true
+					panic("e")
+				}
+			}, "d")
+			Start()
+			assertLog("a\nb\nc\nd\n")
+			Ω(ShutdownPackage("d")).Should(MatchError("shutdown package d: e"))
+			Ω(State()).Should(Equal(Running))
+		})
+
+		It("Shutdown failed in BestEffort", func() {
+			SetShutdownPolicy(BestEffort)
+			Register("e", nil, func() {
+				panic("e")
+			}, "d")
+			Start()
+			assertLog("a\nb\nc\nd\n")
+			Ω(ShutdownPackage("d")).Should(MatchError("shutdown package e: e"))
+			assertLog("~d\n")
+			Ω(State()).Should(Equal(Running))
+			Ω(ShutdownError()).Should(Succeed())
+
+			Shutdown()
+			Ω(ShutdownError()).Should(Succeed())
+			Ω(WaitToEndInfo().Failed).Should(BeEmpty())
+			Ω(ExitCode()).Should(BeZero())
+		})
+
+	})
+
+	Context("StartPackage", func() {
+
+		It("Start dependencies first", func() {
+			Start()
+			Ω(ShutdownPackage("a")).Should(Succeed())
+			assertLog("a\nb\nc\nd\n~d\n~c\n~b\n~a\n")
+			Ω(StartPackage("c")).Should(Succeed())
+			assertLog("a\nb\nc\n")
+			Ω(PackageStartedChan("c")).Should(BeClosed())
+			Ω(PackageStartedChan("d")).ShouldNot(BeClosed())
+
+			Shutdown()
+			assertLog("~c\n~b\n~a\n")
+		})
+
+		It("Already started", func() {
+			Start()
+			Ω(StartPackage("b")).Should(MatchError("package 'b' already started"))
+		})
+
+		It("Not registered", func() {
+			Start()
+			Ω(StartPackage("x")).Should(MatchError("package 'x' not registered"))
+		})
+
+		It("Dependency not registered", func() {
+			Register("e", newLogFunc("e"), newLogFunc("~e"), "x")
+			Start()
+			Ω(ShutdownPackage("e")).Should(Succeed())
+			Ω(StartPackage("e")).Should(MatchError("package 'e' depends on 'x' not registered"))
+		})
+
+		It("Wrong state", func() {
+			Ω(StartPackage("a")).Should(MatchError(`Can not start package "a" in "Initing" state`))
+		})
+
+		It("Start failed", func() {
+			failed := false
+			Register("e", func() {
+				if failed {
+					panic("e")
+				}
+			}, nil, "d")
+			Start()
+			Ω(ShutdownPackage("d")).Should(Succeed())
+			failed = true
+			Ω(StartPackage("e")).Should(MatchError("start package e: e"))
+			Ω(State()).Should(Equal(Running))
+			Ω(PackageStartedChan("d")).Should(BeClosed())
+			Ω(StartPackage("d")).Should(MatchError("package 'd' already started"))
+		})
+
+	})
+
+})
@@ -1,6 +1,12 @@
 package life_test
 
-import . "github.com/onsi/gomega"
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	. "github.com/onsi/gomega"
+)
 
 var (
 	slog string
@@ -20,3 +26,26 @@ func newLogFunc(msg string) func() {
 		appendLog(msg)
 	}
 }
+
+// newLogWaiter returns a writer for log.SetOutput(), and a channel closed
+// after a line containing sub written. Used to wait goroutines outlive the
+// test, such as timed out hooks.
+func newLogWaiter(out io.Writer, sub string) (io.Writer, <-chan struct{}) {
+	w := &logWaiter{out: out, sub: []byte(sub), done: make(chan struct{})}
+	return w, w.done
+}
+
+type logWaiter struct {
+	out  io.Writer
+	sub  []byte
+	once sync.Once
+	done chan struct{}
+}
+
+func (w *logWaiter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	if bytes.Contains(p, w.sub) {
+		w.once.Do(func() { close(w.done) })
+	}
+	return n, err
+}
@@ -0,0 +1,53 @@
+package life
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// RegisterWorkers register a package runs n worker goroutines. Workers start
+// on start of the package, ctx cancelled on its shutdown, then shutdown
+// blocks until all workers return, at most the shutdown timeout, see
+// SetShutdownTimeout(). n must be positive.
+func RegisterWorkers(name string, n int, worker func(ctx context.Context), depends ...string) {
+	if n <= 0 {
+		log.Panicf("[%s] Workers number of \"%s\" must be positive, got %d", tag, name, n)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		cancel context.CancelFunc
+	)
+
+	onStart := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			goBackground(func() {
+				defer wg.Done()
+				worker(ctx)
+			})
+		}
+	}
+
+	onShutdown := func() {
+		cancel()
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		timeout := budgetTimeout(shutdownTimeout)
+		select {
+		case <-done:
+		case <-clock.After(timeout):
+			warnPkgf(name, "Workers of %s not return in %v", name, timeout)
+		}
+	}
+
+	Register(name, onStart, onShutdown, depends...)
+}
@@ -0,0 +1,101 @@
+package life_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/redforks/life"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/redforks/testing/matcher"
+	"github.com/redforks/testing/reset"
+)
+
+var _ = Describe("Workers", func() {
+
+	BeforeEach(func() {
+		reset.Enable()
+	})
+
+	AfterEach(func() {
+		reset.Disable()
+	})
+
+	It("Drain on shutdown", func() {
+		var running, stopped int32
+		RegisterWorkers("workers", 3, func(ctx context.Context) {
+			atomic.AddInt32(&running, 1)
+			<-ctx.Done()
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&stopped, 1)
+		})
+		Start()
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&running)
+		}).Should(Equal(int32(3)))
+
+		Shutdown()
+		Ω(atomic.LoadInt32(&stopped)).Should(Equal(int32(3)))
+	})
+
+	It("Bounded by shutdown timeout", func() {
+		SetShutdownTimeout(10 * time.Millisecond)
+		hold := make(chan struct{})
+		defer close(hold)
+		RegisterWorkers("workers", 1, func(context.Context) {
+			<-hold
+		})
+		Start()
+
+		start := time.Now()
+		Shutdown()
+		Ω(time.Since(start)).Should(BeNumerically("<", 50*time.Millisecond))
+	})
+
+	It("Timeout by clock", func() {
+		clk := &fakeClock{time.Unix(0, 0), make(chan time.Time, 1)}
+		SetClock(clk)
+		hold := make(chan struct{})
+		defer close(hold)
+		RegisterWorkers("workers", 1, func(context.Context) {
+			<-hold
+		})
+		Start()
+
+		clk.after <- clk.now
+		Shutdown()
+		Ω(State()).Should(Equal(Halt))
+	})
+
+	It("Non-positive number", func() {
+		Ω(func() {
+			RegisterWorkers("workers", 0, nil)
+		}).Should(matcher.Panics(`[life] Workers number of "workers" must be positive, got 0`))
+		Ω(func() {
+			RegisterWorkers("workers", -1, nil)
+		}).Should(matcher.Panics(`[life] Workers number of "workers" must be positive, got -1`))
+	})
+
+	It("WaitGoroutines", func() {
+		hold := make(chan struct{})
+		RegisterWorkers("workers", 2, func(context.Context) {
+			<-hold
+		})
+		ShutdownOn(make(chan struct{}))
+		Start()
+		Ω(WaitGoroutines(10 * time.Millisecond)).Should(BeFalse())
+
+		close(hold)
+		Shutdown()
+		Ω(WaitGoroutines(time.Second)).Should(BeTrue())
+	})
+
+	It("Depends", func() {
+		RegisterWorkers("workers", 1, func(context.Context) {}, "db")
+		Register("db", nil, nil)
+		Ω(StartOrder()).Should(Equal([]string{"db", "workers"}))
+	})
+
+})